@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"github.com/chainguard-dev/tw/pkg/commands/helm"
 	"github.com/chainguard-dev/tw/pkg/commands/kgrep"
 	"github.com/chainguard-dev/tw/pkg/commands/kimages"
+	"github.com/chainguard-dev/tw/pkg/commands/ksnap"
 	"github.com/chainguard-dev/tw/pkg/commands/sfuzz"
 	"github.com/chainguard-dev/tw/pkg/commands/shelldeps"
 	"github.com/chainguard-dev/tw/pkg/commands/shu"
@@ -26,6 +28,7 @@ var cmds = map[string]*cobra.Command{
 	"sfuzz":           sfuzz.Command(),
 	"kgrep":           kgrep.Command(),
 	"kimages":         kimages.Command(),
+	"ksnap":           ksnap.Command(),
 	"wassert":         wassert.Command(),
 	"shu":             shu.Command(),
 	"helm-inventory":  helm.Command(),
@@ -38,7 +41,7 @@ func main() {
 	if cmd, ok := cmds[ename]; ok {
 		if err := cmd.Execute(); err != nil {
 			clog.ErrorContextf(cmd.Context(), "%s: failed to execute command: %v", ename, err)
-			os.Exit(1)
+			os.Exit(exitCode(err))
 		}
 		os.Exit(0)
 	}
@@ -71,7 +74,17 @@ func main() {
 
 	if err := cmd.Execute(); err != nil {
 		clog.ErrorContextf(cmd.Context(), "failed to execute command: %v", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 	os.Exit(0)
 }
+
+// exitCode returns the status to exit with for err, commands that wrap
+// another process may ask for its status to be passed through.
+func exitCode(err error) int {
+	var ec *shu.ExitCodeError
+	if errors.As(err, &ec) {
+		return ec.Code
+	}
+	return 1
+}
@@ -6,5 +6,5 @@ package main_test
 import "github.com/chainguard-dev/tw/pkg/commands/ptrace"
 
 func init() {
-	cmds["ptrace"] = ptrace.Command()
+	cmds["ptrace"] = ptrace.Command
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/chainguard-dev/tw/pkg/commands/dgrep"
 	"github.com/chainguard-dev/tw/pkg/commands/kgrep"
 	"github.com/chainguard-dev/tw/pkg/commands/kimages"
+	"github.com/chainguard-dev/tw/pkg/commands/ksnap"
 	"github.com/chainguard-dev/tw/pkg/commands/sfuzz"
 	"github.com/chainguard-dev/tw/pkg/commands/shu"
 	"github.com/chainguard-dev/tw/pkg/commands/wassert"
@@ -26,13 +27,23 @@ var (
 	update = flag.Bool("update", false, "update relevant golden files")
 )
 
-var cmds = map[string]*cobra.Command{
-	"dgrep":   dgrep.Command(),
-	"sfuzz":   sfuzz.Command(),
-	"kgrep":   kgrep.Command(),
-	"kimages": kimages.Command(),
-	"wassert": wassert.Command(),
-	"shu":     shu.Command(),
+// cmds builds a fresh command for every invocation, so flags and state
+// from one don't carry over to the next.
+var cmds = map[string]func() *cobra.Command{
+	"dgrep":   dgrep.Command,
+	"sfuzz":   sfuzz.Command,
+	"kgrep":   kgrep.Command,
+	"kimages": kimages.Command,
+	"ksnap":   ksnap.Command,
+	"wassert": wassert.Command,
+	"shu":     shu.Command,
+}
+
+// dirFlags name the flag a command resolves relative paths against. They
+// run in-process and share its working directory, so they're pointed at the
+// script's directory with it instead.
+var dirFlags = map[string]string{
+	"wassert": "--dir",
 }
 
 func TestMain(m *testing.M) {
@@ -53,8 +64,8 @@ func TestScript(t *testing.T) {
 	ctx := t.Context()
 
 	tscmds := map[string]func(ts *testscript.TestScript, neg bool, args []string){}
-	for n, cmd := range cmds {
-		tscmds[n] = RegisterCmd(ctx, cmd)
+	for n, newCmd := range cmds {
+		tscmds[n] = RegisterCmd(ctx, newCmd, dirFlags[n])
 	}
 
 	testscript.Run(t, testscript.Params{
@@ -65,9 +76,13 @@ func TestScript(t *testing.T) {
 	})
 }
 
-func RegisterCmd(ctx context.Context, cmd *cobra.Command) func(ts *testscript.TestScript, neg bool, args []string) {
+func RegisterCmd(ctx context.Context, newCmd func() *cobra.Command, dirFlag string) func(ts *testscript.TestScript, neg bool, args []string) {
 	return func(ts *testscript.TestScript, neg bool, args []string) {
+		cmd := newCmd()
 		ctx = clog.WithLogger(ctx, clog.New(NewTestScriptLogger(ts).Handler()))
+		if dirFlag != "" {
+			args = append([]string{dirFlag + "=" + ts.MkAbs(".")}, args...)
+		}
 		cmd.SetArgs(args)
 		cmd.SetOut(ts.Stdout())
 		cmd.SetErr(ts.Stderr())
@@ -0,0 +1,80 @@
+package dgrep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"golang.org/x/sync/errgroup"
+)
+
+// composeProjectLabel is set by docker compose on every container it runs.
+const composeProjectLabel = "com.docker.compose.project"
+
+// containers resolves the CONTAINER argument or the selectors to the names
+// of the containers to grep. Stopped containers are included so crashes
+// still show up.
+func (c *cfg) containers(ctx context.Context, cli *client.Client) ([]string, error) {
+	if c.Container != "" {
+		return []string{c.Container}, nil
+	}
+
+	args := filters.NewArgs()
+	for _, label := range c.Labels {
+		args.Add("label", label)
+	}
+	if c.ComposeProject != "" {
+		args.Add("label", composeProjectLabel+"="+c.ComposeProject)
+	}
+
+	list, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	names := []string{}
+	for _, ct := range list {
+		if len(ct.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(ct.Names[0], "/")
+		if c.nameRegex != nil && !c.nameRegex.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no containers match the selectors")
+	}
+
+	slices.Sort(names)
+	clog.InfoContextf(ctx, "selected %d container(s): %s", len(names), strings.Join(names, ", "))
+
+	return names, nil
+}
+
+// forEachContainer runs fn on every container concurrently and returns the
+// failures of all of them, rather than just the first.
+func forEachContainer(ctx context.Context, names []string, fn func(context.Context, string) error) error {
+	errs := make([]error, len(names))
+
+	var g errgroup.Group
+	for i, name := range names {
+		g.Go(func() error {
+			if err := fn(ctx, name); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return errors.Join(errs...)
+}
@@ -6,17 +6,14 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
-	"slices"
-	"strings"
 	"time"
 
 	"github.com/chainguard-dev/clog"
+	"github.com/chainguard-dev/tw/pkg/logmatch"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
-	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
@@ -25,45 +22,28 @@ const (
 	DefaultTimeout = 15 * time.Second
 )
 
-// Common error patterns for --std-errors flag
-var commonErrorPatterns = []string{
-	"ERROR",
-	"FATAL",
-	"FAIL",
-	"Exception",
-	"panic",
-	"Traceback.*most.recent.call",
-	"command not found",
-	"java.lang.*Exception",
-	"segmentation fault",
-	"org.jruby.exceptions",
-	"Gem::MissingSpecError",
-	"Permission denied",
-}
-
 type cfg struct {
-	Container          string
-	Timeout            time.Duration
-	IgnoreCase         bool
-	Retry              int
-	Patterns           []string
-	NotExpected        []string
-	NotExpectedExclude []string
-	InvertMatch        bool
-	DefaultErrors      bool
-
-	compiled            []*regexp.Regexp
-	notExpectedCompiled []*regexp.Regexp
-	highlighter         func(string) string
+	Container      string
+	Timeout        time.Duration
+	Retry          int
+	Follow         bool
+	Labels         []string
+	NameRegex      string
+	ComposeProject string
+	Matching       logmatch.Config
+	Window         logmatch.Window
+
+	nameRegex *regexp.Regexp
+	reports   logmatch.Reports
 }
 
 func Command() *cobra.Command {
-	cfg := &cfg{}
+	cfg := &cfg{Matching: logmatch.Config{IgnoreCase: true}}
 
 	cmd := &cobra.Command{
-		Use:          "dgrep CONTAINER [PATTERN]",
+		Use:          "dgrep [CONTAINER] [PATTERN]",
 		Short:        "Simple docker container log grepping",
-		Args:         cobra.MinimumNArgs(1),
+		Args:         cobra.ArbitraryArgs,
 		SilenceUsage: true,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return cfg.prerun(cmd.Context(), args)
@@ -75,12 +55,12 @@ func Command() *cobra.Command {
 
 	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", DefaultTimeout, "time to wait for logs to appear")
 	cmd.Flags().IntVarP(&cfg.Retry, "retry", "r", 3, "number of times to retry a failed request")
-	cmd.Flags().BoolVarP(&cfg.IgnoreCase, "ignore-case", "i", true, "toggle to ignore case for the match")
-	cmd.Flags().StringArrayVarP(&cfg.Patterns, "regexp", "e", nil, "regular expression to match (must be present)")
-	cmd.Flags().StringArrayVar(&cfg.NotExpected, "ne", nil, "regular expression that must NOT be present")
-	cmd.Flags().StringArrayVar(&cfg.NotExpectedExclude, "ne-exclude", nil, "exclude specific patterns from --std-errors (only works with --std-errors)")
-	cmd.Flags().BoolVar(&cfg.DefaultErrors, "std-errors", false, fmt.Sprintf("check for %d standard error patterns", len(commonErrorPatterns)))
-	cmd.Flags().BoolVarP(&cfg.InvertMatch, "invert-match", "v", false, "toggle to invert the match")
+	cfg.Matching.AddFlags(cmd)
+	cmd.Flags().StringArrayVarP(&cfg.Labels, "label", "l", nil, "grep every container with this label, as key or key=value (can be specified multiple times)")
+	cmd.Flags().StringVar(&cfg.NameRegex, "name-regex", "", "grep every container whose name matches this regular expression")
+	cmd.Flags().StringVar(&cfg.ComposeProject, "compose-project", "", "grep every container in this docker compose project")
+	cfg.Window.AddFlags(cmd)
+	cmd.Flags().BoolVarP(&cfg.Follow, "follow", "f", false, "stream the logs until every pattern matches or --timeout is reached, instead of retrying snapshots")
 
 	return cmd
 }
@@ -90,6 +70,31 @@ func (c *cfg) Run(cmd *cobra.Command) error {
 
 	l := clog.FromContext(ctx).With("container", c.Container)
 
+	if err := c.Window.Resolve(time.Now()); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.Window.Save(); err != nil {
+			l.ErrorContext(ctx, "failed to save checkpoint", "err", err)
+		}
+	}()
+	defer func() {
+		if c.Matching.Output != "json" {
+			return
+		}
+		if err := c.reports.Write(cmd.OutOrStdout()); err != nil {
+			l.ErrorContext(ctx, "failed to write report", "err", err)
+		}
+	}()
+
+	if c.Follow {
+		if err := c.follow(ctx); err != nil {
+			return fmt.Errorf("dgrep failed: %v", err)
+		}
+		l.InfoContext(ctx, "dgrep succeeded", "timeout", c.Timeout)
+		return nil
+	}
+
 	attempt := 0
 	err := wait.ExponentialBackoffWithContext(ctx, wait.Backoff{
 		Steps:    c.Retry + 1,
@@ -120,195 +125,98 @@ func (c *cfg) retryableRun(ctx context.Context) error {
 	}
 	defer cli.Close()
 
-	options := container.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     false,
-		Timestamps: true,
+	c.reports.Reset()
+
+	containers, err := c.containers(ctx, cli)
+	if err != nil {
+		return err
 	}
 
+	return forEachContainer(ctx, containers, func(ctx context.Context, name string) error {
+		return c.grep(ctx, cli, name)
+	})
+}
+
+// grep checks a snapshot of a single container's logs.
+func (c *cfg) grep(ctx context.Context, cli *client.Client, name string) (err error) {
+	m := c.Matching.NewMatcher("container " + name)
+	defer func() { c.reports.Add(m.Report(err)) }()
+
+	options := c.logsOptions(false)
+
 	// Set a timeout for the context
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, c.Timeout)
 	defer cancel()
 
-	reader, err := cli.ContainerLogs(ctx, c.Container, options)
+	reader, err := cli.ContainerLogs(ctx, name, options)
 	if err != nil {
 		return fmt.Errorf("failed to get container logs: %v", err)
 	}
 	defer reader.Close()
 
-	matches := []match{}
-	matchedPatterns := make(map[int]bool)
-	notExpectedMatches := []match{}
-
 	// Use stdcopy to properly handle Docker's multiplexed stream format
 	var stdoutBuf, stderrBuf bytes.Buffer
 	if _, err := stdcopy.StdCopy(&stdoutBuf, &stderrBuf, reader); err != nil && err != io.EOF {
 		return fmt.Errorf("error reading container logs: %v", err)
 	}
 
-	// Process stdout
-	scanner := bufio.NewScanner(strings.NewReader(stdoutBuf.String()))
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Check expected patterns
-		for i, re := range c.compiled {
-			if re.MatchString(line) {
-				matches = append(matches, match{
-					Container: c.Container,
-					Text:      re.ReplaceAllStringFunc(line, c.highlighter),
-				})
-				matchedPatterns[i] = true
-				break
-			}
-		}
-
-		// Check not-expected patterns
-		for _, re := range c.notExpectedCompiled {
-			if re.MatchString(line) {
-				notExpectedMatches = append(notExpectedMatches, match{
-					Container: c.Container,
-					Text:      re.ReplaceAllStringFunc(line, c.highlighter),
-				})
-			}
-		}
-	}
-
-	// Process stderr
-	scanner = bufio.NewScanner(strings.NewReader(stderrBuf.String()))
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Check expected patterns
-		for i, re := range c.compiled {
-			if re.MatchString(line) {
-				matches = append(matches, match{
-					Container: c.Container,
-					Text:      re.ReplaceAllStringFunc(line, c.highlighter),
-				})
-				matchedPatterns[i] = true
-			}
-		}
-
-		// Check not-expected patterns
-		for _, re := range c.notExpectedCompiled {
-			if re.MatchString(line) {
-				notExpectedMatches = append(notExpectedMatches, match{
-					Container: c.Container,
-					Text:      re.ReplaceAllStringFunc(line, c.highlighter),
-				})
+	for _, stream := range []struct {
+		name string
+		buf  *bytes.Buffer
+	}{{"stdout", &stdoutBuf}, {"stderr", &stderrBuf}} {
+		scanner := bufio.NewScanner(stream.buf)
+		for scanner.Scan() {
+			ts, text := logmatch.SplitTimestamp(scanner.Text())
+			if !c.Window.Contains(name, ts) {
+				continue
 			}
+			m.Add(logmatch.Line{Source: name, Stream: stream.name, Timestamp: ts, Text: text})
 		}
 	}
 
-	// Print all matches at the end
-	nmatches := len(matches)
-	nNotExpected := len(notExpectedMatches)
-
-	clog.InfoContextf(ctx, "found %d expected matches in container %s", nmatches, c.Container)
-	for i, m := range matches {
-		clog.InfoContextf(ctx, "-- [%d/%d] expected in %s: %s", i+1, nmatches, m.Container, m.Text)
-	}
+	m.Log(ctx)
 
-	if nNotExpected > 0 {
-		clog.InfoContextf(ctx, "found %d not-expected matches in container %s", nNotExpected, c.Container)
-		for i, m := range notExpectedMatches {
-			clog.InfoContextf(ctx, "-- [%d/%d] not-expected in %s: %s", i+1, nNotExpected, m.Container, m.Text)
-		}
-	}
+	return m.Err()
+}
 
-	if c.InvertMatch && nmatches > 0 {
-		return fmt.Errorf("found %d unwanted matches in container %s", nmatches, c.Container)
+// logsOptions requests timestamped logs limited to the --since/--until
+// window and --stream.
+func (c *cfg) logsOptions(follow bool) container.LogsOptions {
+	options := container.LogsOptions{
+		ShowStdout: c.Matching.Stream != "stderr",
+		ShowStderr: c.Matching.Stream != "stdout",
+		Follow:     follow,
+		Timestamps: true,
 	}
-
-	// Fail if any not-expected patterns were found
-	if nNotExpected > 0 {
-		return fmt.Errorf("found %d not-expected matches in container %s", nNotExpected, c.Container)
+	if since := c.Window.SinceTime(); !since.IsZero() {
+		options.Since = since.Format(time.RFC3339Nano)
 	}
-
-	// Check if all expected patterns were matched (only if not using invert match)
-	if !c.InvertMatch && len(c.Patterns) > 0 {
-		if len(matchedPatterns) < len(c.compiled) {
-			// Find which patterns were not matched
-			var missingPatterns []string
-			for i, pattern := range c.Patterns {
-				if !matchedPatterns[i] {
-					missingPatterns = append(missingPatterns, pattern)
-				}
-			}
-			return fmt.Errorf("no match found for expected pattern(s): %v", missingPatterns)
-		}
+	if until := c.Window.UntilTime(); !until.IsZero() {
+		options.Until = until.Format(time.RFC3339Nano)
 	}
-
-	return nil
+	return options
 }
 
 func (c *cfg) prerun(_ context.Context, args []string) error {
-	c.Container = args[0]
-
-	// Validate --ne-exclude requires --std-errors
-	if len(c.NotExpectedExclude) > 0 && !c.DefaultErrors {
-		return fmt.Errorf("--ne-exclude can only be used with --std-errors")
-	}
-
-	// Add default error patterns if --std-errors is specified
-	if c.DefaultErrors {
-		// Start with all default patterns
-		patterns := make([]string, len(commonErrorPatterns))
-		copy(patterns, commonErrorPatterns)
-
-		// Remove excluded patterns
-		for _, exclude := range c.NotExpectedExclude {
-			filtered := []string{}
-			for _, pattern := range patterns {
-				if pattern != exclude {
-					filtered = append(filtered, pattern)
-				}
-			}
-			patterns = filtered
-		}
-
-		// Add defaults (after exclusions) to not-expected patterns
-		c.NotExpected = append(c.NotExpected, patterns...)
-	}
-
-	if len(c.Patterns) == 0 && len(c.NotExpected) == 0 {
-		return fmt.Errorf("expected at least one pattern via -e/--regexp or --ne")
-	}
-
-	// Check for conflicting patterns (same pattern in both -e and --ne)
-	for _, expected := range c.Patterns {
-		if slices.Contains(c.NotExpected, expected) {
-			return fmt.Errorf("conflicting pattern '%s' found in both -e and --ne flags", expected)
-		}
-	}
-
-	for _, p := range c.Patterns {
-		if c.IgnoreCase {
-			p = "(?i)" + p
+	c.Container = ""
+	selectors := len(c.Labels) > 0 || c.NameRegex != "" || c.ComposeProject != ""
+	switch {
+	case len(args) > 0 && selectors:
+		return fmt.Errorf("a CONTAINER can't be combined with --label, --name-regex or --compose-project")
+	case len(args) > 0:
+		c.Container = args[0]
+	case !selectors:
+		return fmt.Errorf("expected a CONTAINER or at least one of --label, --name-regex or --compose-project")
+	}
+
+	if c.NameRegex != "" {
+		re, err := regexp.Compile(c.NameRegex)
+		if err != nil {
+			return fmt.Errorf("invalid --name-regex %q: %v", c.NameRegex, err)
 		}
-		c.compiled = append(c.compiled, regexp.MustCompile(p))
+		c.nameRegex = re
 	}
 
-	for _, p := range c.NotExpected {
-		if c.IgnoreCase {
-			p = "(?i)" + p
-		}
-		c.notExpectedCompiled = append(c.notExpectedCompiled, regexp.MustCompile(p))
-	}
-
-	c.highlighter = func(s string) string {
-		if isatty.IsTerminal(os.Stdout.Fd()) {
-			return "\x1b[32;1m" + s + "\x1b[0m"
-		}
-		return "( " + s + " )"
-	}
-	return nil
-}
-
-type match struct {
-	Container string
-	Text      string
+	return c.Matching.Compile()
 }
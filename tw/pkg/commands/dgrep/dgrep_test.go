@@ -0,0 +1,260 @@
+package dgrep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainguard-dev/tw/pkg/logmatch"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker serves the container list and the logs of every container,
+// recording the filters the list was asked for. With hold, the logs are
+// kept open like a running container's until the client goes away.
+type fakeDocker struct {
+	containers []container.Summary
+	stdout     string
+	stderr     string
+	hold       bool
+
+	filters filters.Args
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/containers/json"):
+		args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.filters = args
+		_ = json.NewEncoder(w).Encode(f.containers)
+	case strings.HasSuffix(r.URL.Path, "/logs"):
+		_, _ = stdcopy.NewStdWriter(w, stdcopy.Stdout).Write([]byte(f.stdout))
+		_, _ = stdcopy.NewStdWriter(w, stdcopy.Stderr).Write([]byte(f.stderr))
+		if f.hold {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newClient(t *testing.T, f *fakeDocker) *client.Client {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+srv.Listener.Addr().String()), client.WithVersion("1.47"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cli.Close() })
+
+	return cli
+}
+
+func TestContainers(t *testing.T) {
+	f := &fakeDocker{containers: []container.Summary{
+		{Names: []string{"/web-2"}},
+		{Names: []string{"/web-1", "/alias"}},
+		{Names: []string{"/db-1"}},
+		{},
+	}}
+	cli := newClient(t, f)
+
+	tests := []struct {
+		name        string
+		cfg         *cfg
+		want        []string
+		wantFilters []string
+		wantErr     string
+	}{{
+		name: "container",
+		cfg:  &cfg{Container: "web-1"},
+		want: []string{"web-1"},
+	}, {
+		name:        "labels",
+		cfg:         &cfg{Labels: []string{"app=web", "tier"}},
+		want:        []string{"db-1", "web-1", "web-2"},
+		wantFilters: []string{"app=web", "tier"},
+	}, {
+		name:        "compose project",
+		cfg:         &cfg{ComposeProject: "shop"},
+		want:        []string{"db-1", "web-1", "web-2"},
+		wantFilters: []string{composeProjectLabel + "=shop"},
+	}, {
+		name: "name regex",
+		cfg:  &cfg{nameRegex: regexp.MustCompile(`^web-`)},
+		want: []string{"web-1", "web-2"},
+	}, {
+		name:    "no match",
+		cfg:     &cfg{nameRegex: regexp.MustCompile(`^cache`)},
+		wantErr: "no containers match the selectors",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.filters = filters.NewArgs()
+
+			got, err := tt.cfg.containers(context.Background(), cli)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+
+			gotFilters := f.filters.Get("label")
+			if tt.wantFilters == nil {
+				require.Empty(t, gotFilters)
+			} else {
+				require.ElementsMatch(t, tt.wantFilters, gotFilters)
+			}
+		})
+	}
+}
+
+func TestGrepReport(t *testing.T) {
+	cli := newClient(t, &fakeDocker{
+		stdout: "2025-01-01T12:00:00Z starting\n2025-01-01T12:00:01Z listening on :8080\n",
+		stderr: "2025-01-01T12:00:02Z ERROR disk full\n",
+	})
+
+	c := &cfg{
+		Timeout:  time.Second,
+		Matching: logmatch.Config{Patterns: []string{"listening"}, NotExpected: []string{"ERROR"}},
+	}
+	require.NoError(t, c.Matching.Compile())
+
+	err := c.grep(context.Background(), cli, "web-1")
+	require.ErrorContains(t, err, "found 1 not-expected matches in container web-1")
+
+	var buf bytes.Buffer
+	require.NoError(t, c.reports.Write(&buf))
+
+	var reports []logmatch.Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &reports))
+	require.Len(t, reports, 1)
+
+	r := reports[0]
+	require.Equal(t, "container web-1", r.Target)
+	require.False(t, r.Passed)
+	require.Equal(t, err.Error(), r.Error)
+
+	require.Len(t, r.Patterns, 1)
+	require.True(t, r.Patterns[0].Matched)
+	require.Equal(t, &logmatch.Match{
+		Pattern:   0,
+		Source:    "web-1",
+		Stream:    "stdout",
+		Timestamp: time.Date(2025, 1, 1, 12, 0, 1, 0, time.UTC),
+		Text:      "listening on :8080",
+	}, r.Patterns[0].Matches[0])
+
+	require.Len(t, r.NotExpected, 1)
+	require.Equal(t, 1, r.NotExpected[0].Count)
+	require.Equal(t, "stderr", r.NotExpected[0].Matches[0].Stream)
+	require.Equal(t, "ERROR disk full", r.NotExpected[0].Matches[0].Text)
+}
+
+func TestFollowContainer(t *testing.T) {
+	tests := []struct {
+		name      string
+		docker    *fakeDocker
+		matching  logmatch.Config
+		timeout   time.Duration
+		wantErr   string
+		wantAfter []string
+	}{{
+		name: "satisfied",
+		docker: &fakeDocker{
+			stdout: "2025-01-01T12:00:00Z starting\n2025-01-01T12:00:01Z listening on :8080\n",
+			hold:   true,
+		},
+		matching: logmatch.Config{Patterns: []string{"listening"}},
+		timeout:  10 * time.Second,
+	}, {
+		name: "satisfied with after-context",
+		docker: &fakeDocker{
+			stdout: "2025-01-01T12:00:01Z listening on :8080\n2025-01-01T12:00:02Z accepting\n2025-01-01T12:00:03Z serving\n",
+			hold:   true,
+		},
+		matching:  logmatch.Config{Patterns: []string{"listening"}, After: 2},
+		timeout:   10 * time.Second,
+		wantAfter: []string{"accepting", "serving"},
+	}, {
+		name: "after-context cut short by the stream ending",
+		docker: &fakeDocker{
+			stdout: "2025-01-01T12:00:01Z listening on :8080\n2025-01-01T12:00:02Z accepting\n",
+		},
+		matching:  logmatch.Config{Patterns: []string{"listening"}, After: 2},
+		timeout:   10 * time.Second,
+		wantAfter: []string{"accepting"},
+	}, {
+		name: "not expected",
+		docker: &fakeDocker{
+			stderr: "2025-01-01T12:00:02Z ERROR disk full\n",
+			hold:   true,
+		},
+		matching: logmatch.Config{Patterns: []string{"listening"}, NotExpected: []string{"ERROR"}},
+		timeout:  10 * time.Second,
+		wantErr:  "found 1 not-expected matches in container web-1, last at 2025-01-01T12:00:02Z on stderr",
+	}, {
+		name: "deadline",
+		docker: &fakeDocker{
+			stdout: "2025-01-01T12:00:00Z starting\n",
+			hold:   true,
+		},
+		matching: logmatch.Config{Patterns: []string{"listening"}},
+		timeout:  100 * time.Millisecond,
+		wantErr:  "no match found for expected pattern(s) within 100ms: [listening]",
+	}, {
+		name: "stream ended",
+		docker: &fakeDocker{
+			stdout: "2025-01-01T12:00:00Z starting\n",
+		},
+		matching: logmatch.Config{Patterns: []string{"listening"}},
+		timeout:  10 * time.Second,
+		wantErr:  "container web-1 logs ended without a match for expected pattern(s): [listening]",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := newClient(t, tt.docker)
+
+			c := &cfg{Timeout: tt.timeout, Matching: tt.matching}
+			require.NoError(t, c.Matching.Compile())
+
+			// The same deadline follow puts on every container
+			ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+			defer cancel()
+
+			err := c.followContainer(ctx, cli, "web-1")
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, c.reports.Write(&buf))
+
+			var reports []logmatch.Report
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &reports))
+			require.Len(t, reports, 1)
+			require.Len(t, reports[0].Patterns[0].Matches, 1)
+			require.Equal(t, tt.wantAfter, reports[0].Patterns[0].Matches[0].After)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package dgrep
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/chainguard-dev/tw/pkg/logmatch"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// follow streams the logs of every selected container until each has
+// matched every expected pattern, and collected the after-context of its
+// last match, failing as soon as the matches can't pass anymore or once the
+// timeout is reached.
+func (c *cfg) follow(ctx context.Context) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %v", err)
+	}
+	defer cli.Close()
+
+	c.reports.Reset()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	containers, err := c.containers(ctx, cli)
+	if err != nil {
+		return err
+	}
+
+	return forEachContainer(ctx, containers, func(ctx context.Context, name string) error {
+		return c.followContainer(ctx, cli, name)
+	})
+}
+
+func (c *cfg) followContainer(ctx context.Context, cli *client.Client, name string) (err error) {
+	m := c.Matching.NewMatcher("container " + name)
+	defer func() { c.reports.Add(m.Report(err)) }()
+
+	reader, err := cli.ContainerLogs(ctx, name, c.logsOptions(true))
+	if err != nil {
+		return fmt.Errorf("failed to get container logs: %v", err)
+	}
+	defer reader.Close()
+
+	lines := make(chan logmatch.Line)
+	go streamLines(ctx, name, reader, lines)
+
+	for {
+		var line logmatch.Line
+		var ok bool
+		select {
+		case line, ok = <-lines:
+		case <-ctx.Done():
+		}
+
+		if !ok {
+			// The deadline passed or the container stopped logging
+			m.Log(ctx)
+			return c.followResult(ctx, name, m)
+		}
+
+		if !c.Window.Contains(line.Source, line.Timestamp) {
+			continue
+		}
+
+		m.Add(line)
+		if err := m.Failed(); err != nil {
+			m.Log(ctx)
+			return fmt.Errorf("%v, last at %s on %s", err, line.Timestamp.Format(time.RFC3339Nano), line.Stream)
+		}
+
+		// Keep reading until the last match has its --after-context
+		if m.Satisfied() && !m.Collecting() {
+			m.Log(ctx)
+			clog.InfoContextf(ctx, "all expected pattern(s) matched in container %s", name)
+			return nil
+		}
+	}
+}
+
+// followResult decides the outcome once the log stream has ended without
+// failing early.
+func (c *cfg) followResult(ctx context.Context, name string, m *logmatch.Matcher) error {
+	missing := m.Missing()
+	if len(missing) == 0 {
+		return m.Err()
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("no match found for expected pattern(s) within %s: %v", c.Timeout, missing)
+	}
+
+	return fmt.Errorf("container %s logs ended without a match for expected pattern(s): %v", name, missing)
+}
+
+// streamLines demultiplexes Docker's log stream into lines, closing lines
+// once the stream ends.
+func streamLines(ctx context.Context, name string, r io.Reader, lines chan<- logmatch.Line) {
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutW, stderrW, r)
+		stdoutW.CloseWithError(err)
+		stderrW.CloseWithError(err)
+	}()
+
+	done := make(chan struct{}, 2)
+	scan := func(stream string, r io.Reader) {
+		defer func() { done <- struct{}{} }()
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			ts, text := logmatch.SplitTimestamp(scanner.Text())
+			line := logmatch.Line{Source: name, Stream: stream, Timestamp: ts, Text: text}
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	go scan("stdout", stdoutR)
+	go scan("stderr", stderrR)
+
+	<-done
+	<-done
+	close(lines)
+}
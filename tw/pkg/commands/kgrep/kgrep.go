@@ -4,20 +4,16 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"os"
-	"regexp"
-	"slices"
 	"strings"
 	"time"
 
 	"github.com/chainguard-dev/clog"
-	"github.com/mattn/go-isatty"
+	"github.com/chainguard-dev/tw/pkg/logmatch"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/kubectl/pkg/cmd/util"
 	"k8s.io/kubectl/pkg/polymorphichelpers"
 )
 
@@ -25,49 +21,30 @@ const (
 	DefaultTimeout = 5 * time.Second
 )
 
-// Common error patterns for --std-errors flag
-var commonErrorPatterns = []string{
-	"ERROR",
-	"FATAL",
-	"FAIL",
-	"Exception",
-	"panic",
-	"Traceback",
-	"command not found",
-	"NullPointerException",
-	"RuntimeException",
-	"TimeoutException",
-	"OutOfMemoryError",
-	"StackOverflow",
-	"segmentation fault",
-}
-
 type cfg struct {
-	Name               string
-	Namespace          string
-	Timeout            time.Duration
-	IgnoreCase         bool
-	Container          string
-	Retry              int
-	Patterns           []string
-	NotExpected        []string
-	NotExpectedExclude []string
-	InvertMatch        bool
-	DefaultErrors      bool
-
-	names               []string
-	compiled            []*regexp.Regexp
-	notExpectedCompiled []*regexp.Regexp
-	highlighter         func(string) string
+	Name                string
+	Namespace           string
+	Timeout             time.Duration
+	Container           string
+	Retry               int
+	Selector            string
+	Previous            bool
+	InitContainers      bool
+	EphemeralContainers bool
+	Matching            logmatch.Config
+	Window              logmatch.Window
+
+	names   []string
+	reports logmatch.Reports
 }
 
 func Command() *cobra.Command {
 	cfg := &cfg{}
 
 	cmd := &cobra.Command{
-		Use:          "kgrep RESOURCE [PATTERN]",
+		Use:          "kgrep [RESOURCE] [PATTERN]",
 		Short:        "Simple kubernetes pod grepping",
-		Args:         cobra.MinimumNArgs(1),
+		Args:         cobra.ArbitraryArgs,
 		SilenceUsage: true,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return cfg.prerun(cmd.Context(), args)
@@ -80,13 +57,17 @@ func Command() *cobra.Command {
 	cmd.Flags().StringVarP(&cfg.Namespace, "namespace", "n", "default", "namespace to install the release into")
 	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", DefaultTimeout, "time to wait for logs to appear")
 	cmd.Flags().IntVarP(&cfg.Retry, "retry", "r", 0, "number of times to retry a failed request")
-	cmd.Flags().BoolVarP(&cfg.IgnoreCase, "ignore-case", "i", false, "toggle to ignore case for the match")
 	cmd.Flags().StringVarP(&cfg.Container, "container", "c", "", "container to grep logs from (if not specified, will search in all)")
-	cmd.Flags().StringArrayVarP(&cfg.Patterns, "regexp", "e", nil, "regular expression to match that must be present")
-	cmd.Flags().StringArrayVar(&cfg.NotExpected, "ne", nil, "regular expression that must NOT be present")
-	cmd.Flags().StringArrayVar(&cfg.NotExpectedExclude, "ne-exclude", nil, "exclude specific patterns from --std-errors (only works with --std-errors)")
-	cmd.Flags().BoolVar(&cfg.DefaultErrors, "std-errors", false, fmt.Sprintf("check for %d standard error patterns", len(commonErrorPatterns)))
-	cmd.Flags().BoolVarP(&cfg.InvertMatch, "invert-match", "v", false, "toggle to invert the match")
+	cmd.Flags().StringVarP(&cfg.Selector, "selector", "l", "", "grep every pod matching this label selector instead of a RESOURCE")
+	cmd.Flags().BoolVarP(&cfg.Previous, "previous", "p", false, "grep the logs of the previous, crashed instance of each container")
+	cmd.Flags().BoolVar(&cfg.InitContainers, "init-containers", true, "include init containers when grepping all containers")
+	cmd.Flags().BoolVar(&cfg.EphemeralContainers, "ephemeral-containers", true, "include ephemeral containers when grepping all containers")
+	cfg.Matching.AddFlags(cmd)
+	cfg.Window.AddFlags(cmd)
+
+	// Clusters only split the streams with the PodLogsQuerySplitStreams
+	// feature gate, and otherwise quietly return both
+	cmd.Flags().Lookup("stream").Usage = "only request lines from this stream, stdout or stderr; needs the PodLogsQuerySplitStreams feature gate, without it both streams are grepped"
 
 	return cmd
 }
@@ -94,7 +75,24 @@ func Command() *cobra.Command {
 func (c *cfg) Run(cmd *cobra.Command) error {
 	ctx := cmd.Context()
 
-	l := clog.FromContext(ctx).With("resource", c.names, "namespace", c.Namespace)
+	l := clog.FromContext(ctx).With("resource", c.names, "selector", c.Selector, "namespace", c.Namespace)
+
+	if err := c.Window.Resolve(time.Now()); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.Window.Save(); err != nil {
+			l.ErrorContext(ctx, "failed to save checkpoint", "err", err)
+		}
+	}()
+	defer func() {
+		if c.Matching.Output != "json" {
+			return
+		}
+		if err := c.reports.Write(cmd.OutOrStdout()); err != nil {
+			l.ErrorContext(ctx, "failed to write report", "err", err)
+		}
+	}()
 
 	attempt := 0
 	err := wait.ExponentialBackoffWithContext(ctx, wait.Backoff{
@@ -120,182 +118,97 @@ func (c *cfg) Run(cmd *cobra.Command) error {
 }
 
 func (c *cfg) retryableRun(ctx context.Context) error {
+	c.reports.Reset()
+
 	getter := genericclioptions.NewConfigFlags(false)
 
-	infos, err := util.NewFactory(getter).NewBuilder().
-		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
-		NamespaceParam(c.Namespace).
-		DefaultNamespace().
-		SingleResourceType().
-		ResourceNames(c.names[0], c.names[1:]...).
-		Do().Infos()
+	obj, err := c.object(ctx, getter)
 	if err != nil {
-		return fmt.Errorf("failed to get infos: %v", err)
+		return err
 	}
 
-	if len(infos) != 1 {
-		return fmt.Errorf("expected 1 info, got %d", len(infos))
+	// The API only narrows logs down to whole seconds and has no --until,
+	// so ask for timestamps and filter each line to the window too
+	lopts := &corev1.PodLogOptions{Timestamps: true, Previous: c.Previous}
+	if since := c.Window.SinceTime(); !since.IsZero() {
+		lopts.SinceTime = &metav1.Time{Time: since}
 	}
-
-	lopts := &corev1.PodLogOptions{}
 	if c.Container != "" {
 		lopts.Container = c.Container
 	}
+	// Picking a stream needs the PodLogsQuerySplitStreams feature gate. The
+	// API doesn't say whether it was honored, so lines aren't labelled with
+	// a stream either way.
+	if c.Matching.Stream != "" {
+		clog.WarnContextf(ctx, "--stream %s is ignored by clusters without the PodLogsQuerySplitStreams feature gate", c.Matching.Stream)
+	}
+	switch c.Matching.Stream {
+	case "stdout":
+		stream := corev1.LogStreamStdout
+		lopts.Stream = &stream
+	case "stderr":
+		stream := corev1.LogStreamStderr
+		lopts.Stream = &stream
+	}
 	lall := lopts.Container == ""
 
-	reqs, err := polymorphichelpers.LogsForObjectFn(getter, infos[0].Object, lopts, 10*time.Second, lall)
+	reqs, err := polymorphichelpers.LogsForObjectFn(getter, obj, lopts, 10*time.Second, lall)
 	if err != nil {
 		return fmt.Errorf("failed to get logs: %v", err)
 	}
 
-	matches := []match{}
-	matchedPatterns := make(map[int]bool)
-	notExpectedMatches := []match{}
+	pods, logs := c.byPod(reqs)
+
+	return forEachPod(ctx, pods, func(ctx context.Context, pod string) error {
+		return c.grepPod(ctx, pod, logs[pod])
+	})
+}
+
+// grepPod checks the logs of a pod's containers together, so each pod has
+// to match the expected patterns in one of its containers.
+func (c *cfg) grepPod(ctx context.Context, pod string, logs []containerLog) (err error) {
+	m := c.Matching.NewMatcher("pod " + pod)
+	defer func() { c.reports.Add(m.Report(err)) }()
 
-	for obj, req := range reqs {
-		stream, err := req.Stream(ctx)
+	for _, cl := range logs {
+		container := containerName(cl.ref.FieldPath)
+		source := pod + "/" + container
+
+		stream, err := cl.req.Stream(ctx)
+		if c.streamUnavailable(err) {
+			clog.WarnContextf(ctx, "no previous logs for container %s in pod %s: %v", container, pod, err)
+			continue
+		}
 		if err != nil {
-			return fmt.Errorf("failed to stream logs: %v", err)
+			return fmt.Errorf("failed to stream logs of container %s in pod %s: %v", container, pod, err)
 		}
 		defer stream.Close()
 
 		scanner := bufio.NewScanner(stream)
 		for scanner.Scan() {
-			line := scanner.Text()
-
-			// Check expected patterns
-			for i, re := range c.compiled {
-				if re.MatchString(line) {
-					matches = append(matches, match{
-						Name:      obj.Name,
-						Namespace: obj.Namespace,
-						Text:      re.ReplaceAllStringFunc(line, c.highlighter),
-					})
-					matchedPatterns[i] = true
-				}
+			ts, text := logmatch.SplitTimestamp(scanner.Text())
+			if !c.Window.Contains(source, ts) {
+				continue
 			}
-
-			// Check not-expected patterns
-			for _, re := range c.notExpectedCompiled {
-				if re.MatchString(line) {
-					notExpectedMatches = append(notExpectedMatches, match{
-						Name:      obj.Name,
-						Namespace: obj.Namespace,
-						Text:      re.ReplaceAllStringFunc(line, c.highlighter),
-					})
-				}
-			}
-		}
-	}
-
-	nmatches := len(matches)
-	nNotExpected := len(notExpectedMatches)
-
-	clog.InfoContextf(ctx, "found %d expected matches in %s", nmatches, infos[0].String())
-	for i, m := range matches {
-		clog.InfoContextf(ctx, "-- [%d/%d] expected in %s/%s: %s", i+1, nmatches, m.Name, m.Namespace, m.Text)
-	}
-
-	if nNotExpected > 0 {
-		clog.InfoContextf(ctx, "found %d not-expected matches in %s", nNotExpected, infos[0].String())
-		for i, m := range notExpectedMatches {
-			clog.InfoContextf(ctx, "-- [%d/%d] not-expected in %s/%s: %s", i+1, nNotExpected, m.Name, m.Namespace, m.Text)
+			m.Add(logmatch.Line{Source: source, Timestamp: ts, Text: text})
 		}
 	}
 
-	if c.InvertMatch && nmatches > 0 {
-		return fmt.Errorf("found %d unwanted matches in %s", nmatches, infos[0].String())
-	}
-
-	// Fail if any not-expected patterns were found
-	if nNotExpected > 0 {
-		return fmt.Errorf("found %d not-expected matches in %s", nNotExpected, infos[0].String())
-	}
+	m.Log(ctx)
 
-	// Check if all expected patterns were matched
-	if !c.InvertMatch && len(c.Patterns) > 0 {
-		if len(matchedPatterns) < len(c.compiled) {
-			// Find which patterns were not matched
-			var missingPatterns []string
-			for i, pattern := range c.Patterns {
-				if !matchedPatterns[i] {
-					missingPatterns = append(missingPatterns, pattern)
-				}
-			}
-			return fmt.Errorf("no match found for expected pattern(s): %v", missingPatterns)
-		}
-	}
-
-	return nil
+	return m.Err()
 }
 
 func (c *cfg) prerun(_ context.Context, args []string) error {
-	c.names = strings.Split(args[0], "/")
-
-	// Validate --ne-exclude requires --std-errors
-	if len(c.NotExpectedExclude) > 0 && !c.DefaultErrors {
-		return fmt.Errorf("--ne-exclude can only be used with --std-errors")
-	}
-
-	// Add default error patterns if --std-errors is specified
-	if c.DefaultErrors {
-		// Start with all default patterns
-		patterns := make([]string, len(commonErrorPatterns))
-		copy(patterns, commonErrorPatterns)
-
-		// Remove excluded patterns
-		for _, exclude := range c.NotExpectedExclude {
-			filtered := []string{}
-			for _, pattern := range patterns {
-				if pattern != exclude {
-					filtered = append(filtered, pattern)
-				}
-			}
-			patterns = filtered
-		}
-
-		// Add defaults (after exclusions) to not-expected patterns
-		c.NotExpected = append(c.NotExpected, patterns...)
-	}
-
-	if len(c.Patterns) == 0 && len(c.NotExpected) == 0 {
-		return fmt.Errorf("expected at least one pattern via -e/--regexp or --ne")
+	c.names = nil
+	switch {
+	case len(args) > 0 && c.Selector != "":
+		return fmt.Errorf("a RESOURCE can't be combined with --selector")
+	case len(args) > 0:
+		c.names = strings.Split(args[0], "/")
+	case c.Selector == "":
+		return fmt.Errorf("expected a RESOURCE or --selector")
 	}
 
-	// Check for conflicting patterns (same pattern in both -e and --ne)
-	for _, expected := range c.Patterns {
-		if slices.Contains(c.NotExpected, expected) {
-			return fmt.Errorf("conflicting pattern '%s' found in both -e and --ne flags", expected)
-		}
-	}
-
-	// Compile expected patterns
-	for _, p := range c.Patterns {
-		if c.IgnoreCase {
-			p = "(?i)" + p
-		}
-		c.compiled = append(c.compiled, regexp.MustCompile(p))
-	}
-
-	// Compile not-expected patterns
-	for _, p := range c.NotExpected {
-		if c.IgnoreCase {
-			p = "(?i)" + p
-		}
-		c.notExpectedCompiled = append(c.notExpectedCompiled, regexp.MustCompile(p))
-	}
-
-	c.highlighter = func(s string) string {
-		if isatty.IsTerminal(os.Stdout.Fd()) {
-			return "\x1b[32;1m" + s + "\x1b[0m"
-		}
-		return "( " + s + " )"
-	}
-	return nil
-}
-
-type match struct {
-	Name      string
-	Namespace string
-	Text      string
+	return c.Matching.Compile()
 }
@@ -0,0 +1,137 @@
+package kgrep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainguard-dev/tw/pkg/logmatch"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// fakeLog serves a fixed container log.
+type fakeLog string
+
+func (f fakeLog) DoRaw(context.Context) ([]byte, error) {
+	return []byte(f), nil
+}
+
+func (f fakeLog) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(f))), nil
+}
+
+func ref(pod, fieldPath string) corev1.ObjectReference {
+	return corev1.ObjectReference{Kind: "Pod", Namespace: "ns", Name: pod, FieldPath: fieldPath}
+}
+
+func TestContainerFieldPaths(t *testing.T) {
+	tests := []struct {
+		fieldPath string
+		typ       string
+		name      string
+	}{
+		{fieldPath: "spec.containers{app}", name: "app"},
+		{fieldPath: "spec.initContainers{setup}", typ: "init", name: "setup"},
+		{fieldPath: "spec.ephemeralContainers{debugger}", typ: "ephemeral", name: "debugger"},
+		{fieldPath: "app", name: "app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fieldPath, func(t *testing.T) {
+			require.Equal(t, tt.typ, containerType(tt.fieldPath))
+			require.Equal(t, tt.name, containerName(tt.fieldPath))
+		})
+	}
+}
+
+func TestByPod(t *testing.T) {
+	reqs := map[corev1.ObjectReference]rest.ResponseWrapper{
+		ref("web-b", "spec.containers{app}"):               fakeLog(""),
+		ref("web-a", "spec.containers{sidecar}"):           fakeLog(""),
+		ref("web-a", "spec.containers{app}"):               fakeLog(""),
+		ref("web-a", "spec.initContainers{setup}"):         fakeLog(""),
+		ref("web-a", "spec.ephemeralContainers{debugger}"): fakeLog(""),
+	}
+
+	fieldPaths := func(logs []containerLog) []string {
+		paths := []string{}
+		for _, l := range logs {
+			paths = append(paths, l.ref.FieldPath)
+		}
+		return paths
+	}
+
+	c := &cfg{InitContainers: true, EphemeralContainers: true}
+	names, pods := c.byPod(reqs)
+	require.Equal(t, []string{"ns/web-a", "ns/web-b"}, names)
+	require.Equal(t, []string{
+		"spec.containers{app}",
+		"spec.containers{sidecar}",
+		"spec.ephemeralContainers{debugger}",
+		"spec.initContainers{setup}",
+	}, fieldPaths(pods["ns/web-a"]))
+	require.Equal(t, []string{"spec.containers{app}"}, fieldPaths(pods["ns/web-b"]))
+
+	c = &cfg{}
+	_, pods = c.byPod(reqs)
+	require.Equal(t, []string{"spec.containers{app}", "spec.containers{sidecar}"}, fieldPaths(pods["ns/web-a"]))
+}
+
+func TestGrepPodReport(t *testing.T) {
+	c := &cfg{
+		InitContainers: true,
+		Matching:       logmatch.Config{Patterns: []string{"ready"}, NotExpected: []string{"ERROR"}},
+	}
+	require.NoError(t, c.Matching.Compile())
+
+	names, pods := c.byPod(map[corev1.ObjectReference]rest.ResponseWrapper{
+		ref("web", "spec.initContainers{setup}"): fakeLog("2025-01-01T12:00:00Z migrating\n"),
+		ref("web", "spec.containers{app}"):       fakeLog("2025-01-01T12:00:01Z ready\n"),
+		ref("db", "spec.containers{db}"):         fakeLog("2025-01-01T12:00:02Z ERROR corrupt page\n"),
+	})
+	for _, pod := range names {
+		_ = c.grepPod(context.Background(), pod, pods[pod])
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, c.reports.Write(&buf))
+
+	var reports []logmatch.Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &reports))
+	require.Len(t, reports, 2)
+
+	db := reports[0]
+	require.Equal(t, "pod ns/db", db.Target)
+	require.False(t, db.Passed)
+	require.Contains(t, db.Error, "found 1 not-expected matches in pod ns/db")
+	require.False(t, db.Patterns[0].Matched)
+	require.Equal(t, "ns/db/db", db.NotExpected[0].Matches[0].Source)
+
+	web := reports[1]
+	require.Equal(t, "pod ns/web", web.Target)
+	require.True(t, web.Passed)
+	require.Empty(t, web.Error)
+	require.Equal(t, &logmatch.Match{
+		Pattern:   0,
+		Source:    "ns/web/app",
+		Timestamp: time.Date(2025, 1, 1, 12, 0, 1, 0, time.UTC),
+		Text:      "ready",
+	}, web.Patterns[0].Matches[0])
+}
+
+func TestForEachPodNamesFailures(t *testing.T) {
+	err := forEachPod(context.Background(), []string{"ns/web", "ns/db", "ns/cache"}, func(_ context.Context, pod string) error {
+		if pod == "ns/web" {
+			return nil
+		}
+		return errors.New("no match found")
+	})
+	require.EqualError(t, err, "ns/db: no match found\nns/cache: no match found")
+}
@@ -0,0 +1,150 @@
+package kgrep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubectl/pkg/cmd/util"
+)
+
+// containerLog is the log request for a single container of a pod.
+type containerLog struct {
+	ref corev1.ObjectReference
+	req rest.ResponseWrapper
+}
+
+// object resolves the RESOURCE argument, or every pod matching --selector
+// as a pod list.
+func (c *cfg) object(ctx context.Context, getter genericclioptions.RESTClientGetter) (runtime.Object, error) {
+	b := util.NewFactory(getter).NewBuilder().
+		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
+		NamespaceParam(c.Namespace).
+		DefaultNamespace()
+
+	if c.Selector == "" {
+		infos, err := b.SingleResourceType().ResourceNames(c.names[0], c.names[1:]...).Do().Infos()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get infos: %v", err)
+		}
+
+		if len(infos) != 1 {
+			return nil, fmt.Errorf("expected 1 info, got %d", len(infos))
+		}
+
+		return infos[0].Object, nil
+	}
+
+	infos, err := b.ResourceTypes("pods").LabelSelectorParam(c.Selector).Flatten().Do().Infos()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	list := &corev1.PodList{}
+	for _, info := range infos {
+		pod, ok := info.Object.(*corev1.Pod)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T listing pods", info.Object)
+		}
+		list.Items = append(list.Items, *pod)
+	}
+
+	if len(list.Items) == 0 {
+		return nil, fmt.Errorf("no pods in namespace %s match selector %s", c.Namespace, c.Selector)
+	}
+
+	clog.InfoContextf(ctx, "selected %d pod(s) matching %s", len(list.Items), c.Selector)
+
+	return list, nil
+}
+
+// byPod groups the log requests by pod, leaving out the container types
+// that weren't asked for. Pods and their containers are sorted.
+func (c *cfg) byPod(reqs map[corev1.ObjectReference]rest.ResponseWrapper) ([]string, map[string][]containerLog) {
+	pods := map[string][]containerLog{}
+	for ref, req := range reqs {
+		switch containerType(ref.FieldPath) {
+		case "init":
+			if !c.InitContainers {
+				continue
+			}
+		case "ephemeral":
+			if !c.EphemeralContainers {
+				continue
+			}
+		}
+
+		pod := ref.Namespace + "/" + ref.Name
+		pods[pod] = append(pods[pod], containerLog{ref: ref, req: req})
+	}
+
+	names := make([]string, 0, len(pods))
+	for pod, logs := range pods {
+		slices.SortFunc(logs, func(a, b containerLog) int {
+			return strings.Compare(a.ref.FieldPath, b.ref.FieldPath)
+		})
+		names = append(names, pod)
+	}
+	slices.Sort(names)
+
+	return names, pods
+}
+
+// streamUnavailable reports whether a container's log can't be read for a
+// reason that shouldn't fail the grep, like --previous on a container that
+// never restarted.
+func (c *cfg) streamUnavailable(err error) bool {
+	return c.Previous && apierrors.IsBadRequest(err)
+}
+
+// containerType is init or ephemeral for those containers, and empty for
+// regular ones, going by a log request's field path like
+// spec.initContainers{setup}.
+func containerType(fieldPath string) string {
+	switch {
+	case strings.HasPrefix(fieldPath, "spec.initContainers"):
+		return "init"
+	case strings.HasPrefix(fieldPath, "spec.ephemeralContainers"):
+		return "ephemeral"
+	}
+	return ""
+}
+
+// containerName extracts the container from a field path like
+// spec.containers{app}.
+func containerName(fieldPath string) string {
+	_, name, ok := strings.Cut(fieldPath, "{")
+	if !ok {
+		return fieldPath
+	}
+	return strings.TrimSuffix(name, "}")
+}
+
+// forEachPod runs fn on every pod concurrently and returns the failures of
+// all of them, rather than just the first.
+func forEachPod(ctx context.Context, names []string, fn func(context.Context, string) error) error {
+	errs := make([]error, len(names))
+
+	var g errgroup.Group
+	for i, name := range names {
+		g.Go(func() error {
+			if err := fn(ctx, name); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return errors.Join(errs...)
+}
@@ -1,21 +1,18 @@
 package kimages
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"time"
 
 	"github.com/chainguard-dev/clog"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/spf13/cobra"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/kubectl/pkg/cmd/util"
-	"k8s.io/kubectl/pkg/polymorphichelpers"
 )
 
 type cfg struct {
@@ -24,14 +21,34 @@ type cfg struct {
 	Timeout             time.Duration
 	EnforceRegistry     string
 	EnforceRegistrySkip string
+	Policy              string
+	FromFile            string
 }
 
 func Command() *cobra.Command {
 	cfg := &cfg{}
 
 	cmd := &cobra.Command{
-		Use:          "kimages",
-		Short:        "List images in Kubernetes resources",
+		Use:   "kimages",
+		Short: "List images in Kubernetes resources",
+		Example: `
+  # Fail on images outside cgr.dev, unpinned or tagged latest, except in kube-system
+  cat > policy.yaml <<EOF
+  rules:
+  - name: chainguard-only
+    allow:
+    - registry: cgr.dev
+      repo: chainguard/*
+  - name: pinned
+    require_digest: true
+  - name: no-latest
+    no_latest: true
+  exceptions:
+  - namespaces: [kube-system]
+    rules: [chainguard-only]
+  EOF
+  kimages -A --policy policy.yaml
+		`,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cfg.Run(cmd, args)
@@ -43,6 +60,8 @@ func Command() *cobra.Command {
 	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", time.Minute, "timeout for the operation")
 	cmd.Flags().StringVar(&cfg.EnforceRegistry, "enforce-registry", "", "enforce all discovered images belong to this registry")
 	cmd.Flags().StringVar(&cfg.EnforceRegistrySkip, "enforce-registry-skip", "^$", "regex pattern to match on image references to skip enforcement of")
+	cmd.Flags().StringVar(&cfg.Policy, "policy", "", "policy file with rules all discovered images must follow")
+	cmd.Flags().StringVarP(&cfg.FromFile, "from-file", "f", "", "read images from rendered manifests in this file, or - for stdin, instead of a cluster")
 
 	return cmd
 }
@@ -50,6 +69,50 @@ func Command() *cobra.Command {
 func (c *cfg) Run(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 
+	pol := &policy{}
+	if c.Policy != "" {
+		var err error
+		if pol, err = loadPolicy(c.Policy); err != nil {
+			return err
+		}
+	}
+	if c.EnforceRegistry != "" {
+		pol.addEnforceRegistry(c.EnforceRegistry, c.EnforceRegistrySkip)
+	}
+	if err := pol.compile(); err != nil {
+		return err
+	}
+
+	var images []ParsedImage
+	var err error
+	if c.FromFile != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("resources can't be combined with --from-file")
+		}
+		images, err = c.fileImages(ctx, cmd.InOrStdin())
+	} else {
+		images, err = c.clusterImages(ctx, args)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(images, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal images: %v", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s\n", out)
+
+	if len(pol.Rules) > 0 {
+		return pol.check(ctx, images)
+	}
+
+	return nil
+}
+
+// clusterImages collects the images of the pods behind args, or of every
+// pod when there are none.
+func (c *cfg) clusterImages(ctx context.Context, args []string) ([]ParsedImage, error) {
 	getter := genericclioptions.NewConfigFlags(false)
 
 	f := util.NewFactory(getter)
@@ -64,124 +127,58 @@ func (c *cfg) Run(cmd *cobra.Command, args []string) error {
 		builder.NamespaceParam(c.Namespace)
 	}
 
-	images := []ParsedImage{}
+	kcli, err := f.KubernetesClientSet()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubernetes client: %v", err)
+	}
+	o := newOwners(kcli)
+
+	var r *resource.Result
 	if len(args) == 0 {
 		// visit all resources with containers (pods)
-		r := builder.ResourceTypes("pods").
+		r = builder.ResourceTypes("pods").
 			SelectAllParam(true).
 			Flatten().Do()
-		if err := r.Err(); err != nil {
-			return fmt.Errorf("failed to build resource: %v", err)
-		}
-
-		if err := r.Visit(func(i *resource.Info, err error) error {
-			if err != nil {
-				return err
-			}
-
-			clog.InfoContext(ctx, "visit", "name", i.Name, "namespace", i.Namespace, "obj", i.String())
-
-			// cast it to a pod
-			pod, ok := i.Object.(*corev1.Pod)
-			if !ok {
-				return fmt.Errorf("failed to cast object to pod")
-			}
-
-			for _, c := range pod.Spec.Containers {
-				pimage, err := parseImage(c.Image)
-				if err != nil {
-					return fmt.Errorf("failed to parse image: %v", err)
-				}
-				images = append(images, pimage)
-			}
-
-			return nil
-		}); err != nil {
-			return fmt.Errorf("failed to visit resources: %v", err)
-		}
-
 	} else {
 		clog.InfoContext(ctx, "visit", "args", args)
-		r := builder.ResourceTypeOrNameArgs(true, args...).Flatten().Do()
-		if err := r.Err(); err != nil {
-			return fmt.Errorf("failed to build resource: %v", err)
-		}
+		r = builder.ResourceTypeOrNameArgs(true, args...).Flatten().Do()
+	}
+	if err := r.Err(); err != nil {
+		return nil, fmt.Errorf("failed to build resource: %v", err)
+	}
 
-		kcli, err := f.KubernetesClientSet()
+	images := []ParsedImage{}
+	if err := r.Visit(func(i *resource.Info, err error) error {
 		if err != nil {
-			return fmt.Errorf("failed to get kubernetes client: %v", err)
-		}
-
-		if err := r.Visit(func(i *resource.Info, err error) error {
-			if err != nil {
-				return err
-			}
-
-			clog.InfoContext(ctx, "visit", "name", i.Name, "namespace", i.Namespace, "obj", i.String())
-
-			ns, selector, err := polymorphichelpers.SelectorsForObject(i.Object)
-			if err != nil {
-				return fmt.Errorf("failed to get selectors for object: %v", err)
-			}
-
-			pods, err := kcli.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
-				LabelSelector: selector.String(),
-			})
-			if err != nil {
-				return fmt.Errorf("failed to list pods: %v", err)
-			}
-			for _, pod := range pods.Items {
-				for _, c := range pod.Spec.Containers {
-					pimage, err := parseImage(c.Image)
-					if err != nil {
-						return fmt.Errorf("failed to parse image: %v", err)
-					}
-					images = append(images, pimage)
-				}
-			}
-
-			return nil
-		}); err != nil {
-			return fmt.Errorf("failed to visit resources: %v", err)
+			return err
 		}
-	}
-
-	out, err := json.MarshalIndent(images, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal images: %v", err)
-	}
-	fmt.Fprintf(cmd.OutOrStdout(), "%s\n", out)
 
-	if c.EnforceRegistry != "" {
-		violations := []ParsedImage{}
+		clog.InfoContext(ctx, "visit", "name", i.Name, "namespace", i.Namespace, "obj", i.String())
 
-		skipPattern, err := regexp.Compile(c.EnforceRegistrySkip)
+		pods, err := podsForInfo(ctx, kcli, o, i)
 		if err != nil {
-			return fmt.Errorf("failed to compile skip pattern %q: %v", c.EnforceRegistrySkip, err)
+			return err
 		}
 
-		for _, image := range images {
-			if image.Registry != c.EnforceRegistry {
-				if skipPattern.MatchString(image.Ref) {
-					clog.InfoContextf(ctx, "skipping enforcement of registry %s on image ref: %q", c.EnforceRegistry, image.Ref)
-					continue
-				}
-				violations = append(violations, image)
+		for _, pod := range pods {
+			owner, err := o.owner(ctx, &pod)
+			if err != nil {
+				return err
 			}
-		}
 
-		if len(violations) > 0 {
-			out, err := json.MarshalIndent(violations, "", "  ")
+			pimages, err := podImages(&pod, owner)
 			if err != nil {
-				return fmt.Errorf("failed to marshal violations: %v", err)
+				return err
 			}
-			return fmt.Errorf("found %d images that do not belong to the enforced registry %q:\n%s", len(violations), c.EnforceRegistry, out)
+			images = append(images, pimages...)
 		}
 
-		clog.InfoContext(ctx, "No registry violations found", "enforced_registry", c.EnforceRegistry)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to visit resources: %v", err)
 	}
 
-	return nil
+	return images, nil
 }
 
 func parseImage(image string) (ParsedImage, error) {
@@ -205,4 +202,14 @@ type ParsedImage struct {
 	RegistryRepo string `json:"registry_repo"`
 	Identifier   string `json:"identifier"`
 	Ref          string `json:"ref"`
+
+	// Container is the container running the image, of Type container,
+	// init or ephemeral, in Pod. Owner is the pod's workload as Kind/name,
+	// and ResolvedDigest the digest the runtime actually pulled for Ref.
+	Container      string `json:"container,omitempty"`
+	Type           string `json:"type,omitempty"`
+	Pod            string `json:"pod,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	Owner          string `json:"owner,omitempty"`
+	ResolvedDigest string `json:"resolved_digest,omitempty"`
 }
@@ -0,0 +1,142 @@
+package kimages
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// fileImages collects the images from rendered manifests, like the output
+// of helm template, read from --from-file or stdin for -.
+func (c *cfg) fileImages(ctx context.Context, stdin io.Reader) ([]ParsedImage, error) {
+	r := stdin
+	if c.FromFile != "-" {
+		f, err := os.Open(c.FromFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", c.FromFile, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	images := []ParsedImage{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", c.FromFile, err)
+		}
+
+		dimages, err := c.docImages(ctx, doc)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, dimages...)
+	}
+
+	return images, nil
+}
+
+// docImages collects the images from a single YAML document. Documents
+// without a pod spec, including unknown kinds like CRDs, are skipped.
+func (c *cfg) docImages(ctx context.Context, doc []byte) ([]ParsedImage, error) {
+	// Skip empty and comment only documents
+	tm := metav1.TypeMeta{}
+	if err := yaml.Unmarshal(doc, &tm); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	if tm.Kind == "" {
+		return nil, nil
+	}
+
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		clog.InfoContext(ctx, "skipping unknown kind", "kind", tm.Kind, "apiVersion", tm.APIVersion)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", tm.Kind, err)
+	}
+
+	if list, ok := obj.(*corev1.List); ok {
+		images := []ParsedImage{}
+		for _, item := range list.Items {
+			iimages, err := c.docImages(ctx, item.Raw)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, iimages...)
+		}
+		return images, nil
+	}
+
+	meta, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, nil
+	}
+
+	spec := podSpecOf(obj)
+	if spec == nil {
+		return nil, nil
+	}
+
+	clog.InfoContext(ctx, "visit", "kind", tm.Kind, "name", meta.GetName(), "namespace", meta.GetNamespace())
+
+	pod := &corev1.Pod{Spec: *spec}
+	pod.Namespace = meta.GetNamespace()
+	if pod.Namespace == "" {
+		pod.Namespace = c.Namespace
+	}
+
+	owner := ""
+	if _, ok := obj.(*corev1.Pod); ok {
+		pod.Name = meta.GetName()
+	} else {
+		owner = tm.Kind + "/" + meta.GetName()
+	}
+
+	return podImages(pod, owner)
+}
+
+// podSpecOf returns the pod spec of the kinds that have one, or nil.
+func podSpecOf(obj runtime.Object) *corev1.PodSpec {
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		return &o.Spec
+	case *corev1.PodTemplate:
+		return &o.Template.Spec
+	case *corev1.ReplicationController:
+		if o.Spec.Template != nil {
+			return &o.Spec.Template.Spec
+		}
+	case *appsv1.Deployment:
+		return &o.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template.Spec
+	case *appsv1.ReplicaSet:
+		return &o.Spec.Template.Spec
+	case *batchv1.Job:
+		return &o.Spec.Template.Spec
+	case *batchv1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package kimages
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/polymorphichelpers"
+)
+
+// Container types, as recorded in ParsedImage.Type.
+const (
+	typeContainer = "container"
+	typeInit      = "init"
+	typeEphemeral = "ephemeral"
+)
+
+// owners resolves the workload owning a pod, following ReplicaSets up to
+// their Deployment and Jobs up to their CronJob.
+type owners struct {
+	kcli  kubernetes.Interface
+	cache map[string]string
+}
+
+func newOwners(kcli kubernetes.Interface) *owners {
+	return &owners{kcli: kcli, cache: map[string]string{}}
+}
+
+// owner returns the owning workload as Kind/name, or an empty string for a
+// bare pod.
+func (o *owners) owner(ctx context.Context, pod *corev1.Pod) (string, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return "", nil
+	}
+
+	key := pod.Namespace + "/" + ref.Kind + "/" + ref.Name
+	if owner, ok := o.cache[key]; ok {
+		return owner, nil
+	}
+
+	var parent metav1.Object
+	var err error
+	switch ref.Kind {
+	case "ReplicaSet":
+		parent, err = o.kcli.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	case "Job":
+		parent, err = o.kcli.BatchV1().Jobs(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to get %s %s: %v", ref.Kind, ref.Name, err)
+	}
+
+	owner := ref.Kind + "/" + ref.Name
+	if err == nil && parent != nil {
+		if pref := metav1.GetControllerOf(parent); pref != nil {
+			owner = pref.Kind + "/" + pref.Name
+		}
+	}
+
+	o.cache[key] = owner
+
+	return owner, nil
+}
+
+// podsForInfo lists the pods behind a resource. Pods are taken as they
+// are, resources with a selector list the pods it selects and anything
+// else, like a CronJob, lists the pods it ends up owning.
+func podsForInfo(ctx context.Context, kcli kubernetes.Interface, o *owners, i *resource.Info) ([]corev1.Pod, error) {
+	if pod, ok := i.Object.(*corev1.Pod); ok {
+		return []corev1.Pod{*pod}, nil
+	}
+
+	ns, selector, err := polymorphichelpers.SelectorsForObject(i.Object)
+	if err == nil {
+		pods, err := kcli.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: selector.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %v", err)
+		}
+		return pods.Items, nil
+	}
+
+	clog.InfoContext(ctx, "no selector, matching pods by owner", "obj", i.String(), "err", err)
+
+	kind := i.Object.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" && i.Mapping != nil {
+		kind = i.Mapping.GroupVersionKind.Kind
+	}
+	want := kind + "/" + i.Name
+
+	pods, err := kcli.CoreV1().Pods(i.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	owned := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		owner, err := o.owner(ctx, &pod)
+		if err != nil {
+			return nil, err
+		}
+		if owner == want {
+			owned = append(owned, pod)
+		}
+	}
+
+	return owned, nil
+}
+
+// podImages parses the image of every init, regular and ephemeral
+// container in a pod.
+func podImages(pod *corev1.Pod, owner string) ([]ParsedImage, error) {
+	type container struct {
+		typ, name, image string
+	}
+
+	containers := []container{}
+	for _, c := range pod.Spec.InitContainers {
+		containers = append(containers, container{typeInit, c.Name, c.Image})
+	}
+	for _, c := range pod.Spec.Containers {
+		containers = append(containers, container{typeContainer, c.Name, c.Image})
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, container{typeEphemeral, c.Name, c.Image})
+	}
+
+	digests := map[string]string{}
+	for _, statuses := range [][]corev1.ContainerStatus{
+		pod.Status.InitContainerStatuses,
+		pod.Status.ContainerStatuses,
+		pod.Status.EphemeralContainerStatuses,
+	} {
+		for _, s := range statuses {
+			digests[s.Name] = imageDigest(s.ImageID)
+		}
+	}
+
+	images := make([]ParsedImage, 0, len(containers))
+	for _, c := range containers {
+		pimage, err := parseImage(c.image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image of container %s in %s: %v", c.name, cmp.Or(pod.Name, owner), err)
+		}
+		pimage.Container = c.name
+		pimage.Type = c.typ
+		pimage.Pod = pod.Name
+		pimage.Namespace = pod.Namespace
+		pimage.Owner = owner
+		pimage.ResolvedDigest = digests[c.name]
+		images = append(images, pimage)
+	}
+
+	return images, nil
+}
+
+// imageDigest extracts the digest from a container status imageID like
+// docker-pullable://repo@sha256:... or repo@sha256:.... A bare sha256:...
+// is the local image ID rather than a registry digest, so it's left out.
+func imageDigest(imageID string) string {
+	_, digest, _ := strings.Cut(imageID, "@")
+	return digest
+}
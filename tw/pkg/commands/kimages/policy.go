@@ -0,0 +1,236 @@
+package kimages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"sigs.k8s.io/yaml"
+)
+
+// enforceRegistryRule names the rule --enforce-registry adds to the policy.
+const enforceRegistryRule = "enforce-registry"
+
+type policy struct {
+	Rules      []policyRule      `json:"rules"`
+	Exceptions []policyException `json:"exceptions,omitempty"`
+}
+
+// policyRule is violated by an image failing any of its constraints.
+type policyRule struct {
+	Name string `json:"name"`
+	// Allow lists the only images permitted, Deny the images that aren't.
+	Allow []imageMatch `json:"allow,omitempty"`
+	Deny  []imageMatch `json:"deny,omitempty"`
+	// RequireDigest requires images to be pinned by digest, NoLatest
+	// forbids the latest tag, including when no tag is given.
+	RequireDigest bool `json:"require_digest,omitempty"`
+	NoLatest      bool `json:"no_latest,omitempty"`
+
+	// registry is set on the rule --enforce-registry adds, which keeps the
+	// flag's own error message.
+	registry string
+}
+
+// imageMatch matches images whose registry and repo both match the globs
+// given, where * doesn't cross a /.
+type imageMatch struct {
+	Registry string `json:"registry,omitempty"`
+	Repo     string `json:"repo,omitempty"`
+}
+
+// policyException exempts images from rules. Every field given has to
+// match: Namespaces are globs, Refs are regular expressions and Rules
+// lists the rules exempted from, all of them when empty.
+type policyException struct {
+	Namespaces []string `json:"namespaces,omitempty"`
+	Refs       []string `json:"refs,omitempty"`
+	Rules      []string `json:"rules,omitempty"`
+
+	refs []*regexp.Regexp
+}
+
+func loadPolicy(p string) (*policy, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %v", p, err)
+	}
+
+	pol := &policy{}
+	if err := yaml.UnmarshalStrict(data, pol); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %v", p, err)
+	}
+
+	// The name is kept for --enforce-registry, so its violations are never
+	// mixed up with a policy rule's
+	for _, r := range pol.Rules {
+		if r.Name == enforceRegistryRule {
+			return nil, fmt.Errorf("policy %s can't have a rule named %q, it's reserved for --enforce-registry", p, r.Name)
+		}
+	}
+
+	return pol, nil
+}
+
+// addEnforceRegistry adds the rule for --enforce-registry, exempting the
+// refs matching --enforce-registry-skip.
+func (p *policy) addEnforceRegistry(registry, skip string) {
+	p.Rules = append(p.Rules, policyRule{
+		Name:     enforceRegistryRule,
+		Allow:    []imageMatch{{Registry: registry}},
+		registry: registry,
+	})
+	p.Exceptions = append(p.Exceptions, policyException{
+		Refs:  []string{skip},
+		Rules: []string{enforceRegistryRule},
+	})
+}
+
+// compile validates the policy and compiles its patterns.
+func (p *policy) compile() error {
+	names := map[string]bool{}
+	for _, r := range p.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("policy rule without a name")
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate policy rule %q", r.Name)
+		}
+		names[r.Name] = true
+
+		for _, m := range slices.Concat(r.Allow, r.Deny) {
+			for _, glob := range []string{m.Registry, m.Repo} {
+				if _, err := path.Match(glob, ""); err != nil {
+					return fmt.Errorf("invalid glob %q in rule %q: %v", glob, r.Name, err)
+				}
+			}
+		}
+	}
+
+	for i := range p.Exceptions {
+		e := &p.Exceptions[i]
+		for _, name := range e.Rules {
+			if !names[name] {
+				return fmt.Errorf("exception for unknown rule %q", name)
+			}
+		}
+		for _, glob := range e.Namespaces {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid namespace glob %q in exception: %v", glob, err)
+			}
+		}
+		e.refs = nil
+		for _, ref := range e.Refs {
+			re, err := regexp.Compile(ref)
+			if err != nil {
+				return fmt.Errorf("failed to compile exception pattern %q: %v", ref, err)
+			}
+			e.refs = append(e.refs, re)
+		}
+	}
+
+	return nil
+}
+
+// check fails with the images violating each rule, grouped by rule.
+func (p *policy) check(ctx context.Context, images []ParsedImage) error {
+	errs := []error{}
+	for _, r := range p.Rules {
+		violations := []ParsedImage{}
+		for _, image := range images {
+			if !r.violatedBy(image) {
+				continue
+			}
+			if p.exempts(r.Name, image) {
+				clog.InfoContextf(ctx, "skipping enforcement of rule %s on image ref: %q", r.Name, image.Ref)
+				continue
+			}
+			violations = append(violations, image)
+		}
+
+		if len(violations) == 0 {
+			continue
+		}
+
+		out, err := json.MarshalIndent(violations, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal violations: %v", err)
+		}
+		if r.registry != "" {
+			errs = append(errs, fmt.Errorf("found %d images that do not belong to the enforced registry %q:\n%s", len(violations), r.registry, out))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("found %d images violating rule %q:\n%s", len(violations), r.Name, out))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	clog.InfoContext(ctx, "No policy violations found", "rules", len(p.Rules))
+
+	return nil
+}
+
+func (r *policyRule) violatedBy(image ParsedImage) bool {
+	if len(r.Allow) > 0 && !slices.ContainsFunc(r.Allow, image.matches) {
+		return true
+	}
+	if slices.ContainsFunc(r.Deny, image.matches) {
+		return true
+	}
+	if r.RequireDigest && !image.pinned() {
+		return true
+	}
+	if r.NoLatest && image.Identifier == "latest" {
+		return true
+	}
+	return false
+}
+
+func (p *policy) exempts(rule string, image ParsedImage) bool {
+	for _, e := range p.Exceptions {
+		if len(e.Rules) > 0 && !slices.Contains(e.Rules, rule) {
+			continue
+		}
+		if len(e.Namespaces) > 0 && !slices.ContainsFunc(e.Namespaces, func(glob string) bool {
+			ok, _ := path.Match(glob, image.Namespace)
+			return ok
+		}) {
+			continue
+		}
+		if len(e.refs) > 0 && !slices.ContainsFunc(e.refs, func(re *regexp.Regexp) bool {
+			return re.MatchString(image.Ref)
+		}) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (i ParsedImage) matches(m imageMatch) bool {
+	if m.Registry != "" {
+		if ok, _ := path.Match(m.Registry, i.Registry); !ok {
+			return false
+		}
+	}
+	if m.Repo != "" {
+		if ok, _ := path.Match(m.Repo, i.Repo); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// pinned reports whether the image is referenced by digest.
+func (i ParsedImage) pinned() bool {
+	return strings.HasPrefix(i.Identifier, "sha256:")
+}
@@ -0,0 +1,158 @@
+package ksnap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+)
+
+// RunCompare diffs the live snapshot of kind against --golden and fails on
+// any drift, unless --update rewrites --golden with the live snapshot.
+func (c *cmdConfig) RunCompare(cmd *cobra.Command, kind string) error {
+	ctx := cmd.Context()
+
+	if c.Golden == "" {
+		return fmt.Errorf("compare requires --golden")
+	}
+
+	live, err := c.snapshot(ctx, kind)
+	if err != nil {
+		return err
+	}
+
+	golden, err := os.ReadFile(c.Golden)
+	if err != nil && !(c.Update && errors.Is(err, os.ErrNotExist)) {
+		return fmt.Errorf("failed to read golden snapshot %s: %v", c.Golden, err)
+	}
+
+	var changes []string
+	if golden != nil {
+		if changes, err = diffSnapshots(golden, live); err != nil {
+			return fmt.Errorf("failed to compare with %s: %v", c.Golden, err)
+		}
+	}
+	for _, change := range changes {
+		fmt.Fprintln(cmd.OutOrStdout(), change)
+	}
+
+	if c.Update {
+		if err := writeSnapshot(c.Golden, live); err != nil {
+			return err
+		}
+		clog.InfoContextf(ctx, "updated %s snapshot %s with %d change(s)", kind, c.Golden, len(changes))
+		return nil
+	}
+
+	if len(changes) > 0 {
+		return fmt.Errorf("%s snapshot drifted from %s with %d change(s)", kind, c.Golden, len(changes))
+	}
+
+	clog.InfoContextf(ctx, "%s snapshot matches %s", kind, c.Golden)
+	return nil
+}
+
+// snapshot takes the live snapshot of kind.
+func (c *cmdConfig) snapshot(ctx context.Context, kind string) (any, error) {
+	switch kind {
+	case "images":
+		return c.images(ctx)
+	case "resources":
+		return c.resources(ctx)
+	case "rbac":
+		return c.rbac(ctx)
+	case "ports":
+		return c.ports(ctx)
+	case "security":
+		return c.security(ctx)
+	default:
+		return nil, fmt.Errorf("unknown snapshot type: %s", kind)
+	}
+}
+
+// diffSnapshots lists the entries added to, removed from and changed in
+// live compared to golden, one line each, sorted by key. Changed entries
+// name the fields that differ.
+func diffSnapshots(golden []byte, live any) ([]string, error) {
+	data, err := json.Marshal(live)
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after map[string]any
+	if err := json.Unmarshal(golden, &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &after); err != nil {
+		return nil, err
+	}
+
+	keys := slices.Sorted(maps.Keys(before))
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	changes := []string{}
+	for _, k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		switch {
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("+ %s: %s", k, compact(a)))
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("- %s: %s", k, compact(b)))
+		case !reflect.DeepEqual(a, b):
+			changes = append(changes, fmt.Sprintf("~ %s: %s", k, fieldChanges(b, a)))
+		}
+	}
+
+	return changes, nil
+}
+
+// fieldChanges describes how an entry changed, field by field when it's
+// an object.
+func fieldChanges(before, after any) string {
+	b, bok := before.(map[string]any)
+	a, aok := after.(map[string]any)
+	if !bok || !aok {
+		return fmt.Sprintf("%s -> %s", compact(before), compact(after))
+	}
+
+	fields := slices.Sorted(maps.Keys(b))
+	for f := range a {
+		if _, ok := b[f]; !ok {
+			fields = append(fields, f)
+		}
+	}
+	slices.Sort(fields)
+
+	var s string
+	for _, f := range fields {
+		if reflect.DeepEqual(b[f], a[f]) {
+			continue
+		}
+		if s != "" {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s %s -> %s", f, compact(b[f]), compact(a[f]))
+	}
+	return s
+}
+
+func compact(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,202 @@
+package ksnap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	tests := []struct {
+		name    string
+		golden  string
+		live    any
+		want    []string
+		wantErr bool
+	}{{
+		name:   "unchanged",
+		golden: `{"a": {"x": 1}}`,
+		live:   map[string]any{"a": map[string]any{"x": 1}},
+		want:   []string{},
+	}, {
+		name:   "added and removed",
+		golden: `{"a": {"x": 1}, "c": {"x": 3}}`,
+		live:   map[string]any{"b": map[string]any{"x": 2}, "c": map[string]any{"x": 3}},
+		want:   []string{`- a: {"x":1}`, `+ b: {"x":2}`},
+	}, {
+		name:   "changed fields",
+		golden: `{"a": {"x": 1, "y": "same", "z": true}}`,
+		live:   map[string]any{"a": map[string]any{"x": 2, "y": "same", "w": "new"}},
+		want:   []string{`~ a: w null -> "new", x 1 -> 2, z true -> null`},
+	}, {
+		name:   "changed values",
+		golden: `{"a": ["x"]}`,
+		live:   map[string]any{"a": []string{"x", "y"}},
+		want:   []string{`~ a: ["x"] -> ["x","y"]`},
+	}, {
+		name: "snapshot struct",
+		golden: `{"cgr.dev/chainguard/nginx": {
+			"context": "cgr.dev/chainguard/nginx",
+			"identifier": "1.25",
+			"container_name": "nginx",
+			"pod_namespace": "web"
+		}}`,
+		live: ImagesSnapshot{"cgr.dev/chainguard/nginx": {
+			Context:       "cgr.dev/chainguard/nginx",
+			Identifier:    "1.27",
+			ContainerName: "nginx",
+			Namespace:     "web",
+		}},
+		want: []string{`~ cgr.dev/chainguard/nginx: identifier "1.25" -> "1.27"`},
+	}, {
+		name:    "invalid golden",
+		golden:  `[]`,
+		live:    map[string]any{},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := diffSnapshots([]byte(tt.golden), tt.live)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func pod(namespace, name, container, image string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: container, Image: image}},
+		},
+	}
+}
+
+func TestRunCompare(t *testing.T) {
+	live := ImagesSnapshot{"cgr.dev/chainguard/nginx": {
+		Context:       "cgr.dev/chainguard/nginx",
+		Identifier:    "1.27",
+		ContainerName: "nginx",
+		Namespace:     "web",
+	}}
+	drifted := ImagesSnapshot{"cgr.dev/chainguard/nginx": {
+		Context:       "cgr.dev/chainguard/nginx",
+		Identifier:    "1.25",
+		ContainerName: "nginx",
+		Namespace:     "web",
+	}}
+
+	tests := []struct {
+		name    string
+		golden  any
+		update  bool
+		want    []string
+		wantErr string
+	}{{
+		name:   "matches",
+		golden: live,
+	}, {
+		name:    "drifted",
+		golden:  drifted,
+		want:    []string{`~ cgr.dev/chainguard/nginx: identifier "1.25" -> "1.27"`},
+		wantErr: "images snapshot drifted from %s with 1 change(s)",
+	}, {
+		name:    "missing golden",
+		wantErr: "failed to read golden snapshot %s",
+	}, {
+		name:   "update drifted",
+		golden: drifted,
+		update: true,
+		want:   []string{`~ cgr.dev/chainguard/nginx: identifier "1.25" -> "1.27"`},
+	}, {
+		name:   "update creates golden",
+		update: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden := filepath.Join(t.TempDir(), "images.json")
+			if tt.golden != nil {
+				require.NoError(t, writeSnapshot(golden, tt.golden))
+			}
+
+			c := &cmdConfig{
+				Namespace: "web",
+				Golden:    golden,
+				Update:    tt.update,
+				clientset: fake.NewClientset(pod("web", "nginx-0", "nginx", "cgr.dev/chainguard/nginx:1.27")),
+			}
+
+			var out bytes.Buffer
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+			cmd.SetOut(&out)
+
+			err := c.RunCompare(cmd, "images")
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, fmt.Sprintf(tt.wantErr, golden))
+			} else {
+				require.NoError(t, err)
+			}
+
+			var lines []string
+			if out.Len() > 0 {
+				lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			}
+			require.Equal(t, tt.want, lines)
+
+			if tt.update {
+				want := filepath.Join(t.TempDir(), "want.json")
+				require.NoError(t, writeSnapshot(want, live))
+				requireSameFile(t, want, golden)
+			}
+		})
+	}
+}
+
+func requireSameFile(t *testing.T, want, got string) {
+	t.Helper()
+
+	w, err := os.ReadFile(want)
+	require.NoError(t, err)
+	g, err := os.ReadFile(got)
+	require.NoError(t, err)
+	require.Equal(t, string(w), string(g))
+}
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"images", "rbac"}, wantErr: `only compare takes a TYPE, got "rbac" after images`},
+		{args: []string{"compare", "images", "rbac"}, wantErr: "accepts between 1 and 2 arg(s), received 3"},
+		{args: []string{}, wantErr: "accepts between 1 and 2 arg(s), received 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd := Command()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			require.EqualError(t, cmd.Execute(), tt.wantErr)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/chainguard-dev/clog"
@@ -22,42 +23,84 @@ const (
 type cmdConfig struct {
 	Namespace string
 	OutPath   string
+	Golden    string
+	Update    bool
 
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
 func Command() *cobra.Command {
 	cfg := &cmdConfig{}
 
 	cmd := &cobra.Command{
-		Use:   "ksnap",
+		Use:   "ksnap images|resources|rbac|ports|security|compare [TYPE]",
 		Short: "Simple kubernetes snapshot testing",
-		Args:  cobra.MinimumNArgs(1),
+		Example: `
+  # Snapshot the images running in a namespace
+  ksnap images -n cert-manager -o images.json
+
+  # Snapshot the RBAC rules that apply to a namespace
+  ksnap rbac -n cert-manager -o rbac.json
+
+  # Fail when the images drift from a stored snapshot
+  ksnap compare images -n cert-manager --golden images.json
+
+  # Refresh the stored snapshot
+  ksnap compare images -n cert-manager --golden images.json --update
+		`,
+		Args: cobra.MatchAll(cobra.RangeArgs(1, 2), func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 && args[0] != "compare" {
+				return fmt.Errorf("only compare takes a TYPE, got %q after %s", args[1], args[0])
+			}
+			return nil
+		}),
+		SilenceUsage: true,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return cfg.prerun(cmd.Context())
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			switch args[0] {
-			case "images":
-				cfg.RunImages(cmd.Context())
+			case "images", "resources", "rbac", "ports", "security":
+				return cfg.RunSnapshot(cmd.Context(), args[0])
+			case "compare":
+				kind := "images"
+				if len(args) > 1 {
+					kind = args[1]
+				}
+				return cfg.RunCompare(cmd, kind)
 			default:
 				return fmt.Errorf("unknown subcommand: %s", args[0])
 			}
-
-			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&cfg.Namespace, "namespace", "n", "", "namespace to snapshot")
-	cmd.Flags().StringVarP(&cfg.OutPath, "out", "o", "", "path to output file")
+	cmd.Flags().StringVarP(&cfg.OutPath, "out", "o", "ksnap.out.json", "path to output file")
+	cmd.Flags().StringVar(&cfg.Golden, "golden", "", "snapshot to compare against with compare")
+	cmd.Flags().BoolVar(&cfg.Update, "update", false, "write the live snapshot to --golden instead of failing on drift")
 
 	return cmd
 }
 
-func (c *cmdConfig) RunImages(ctx context.Context) error {
+// RunSnapshot writes the live snapshot of kind to --out.
+func (c *cmdConfig) RunSnapshot(ctx context.Context, kind string) error {
+	snap, err := c.snapshot(ctx, kind)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(c.OutPath, snap); err != nil {
+		return err
+	}
+
+	clog.InfoContextf(ctx, "wrote %s snapshot with %d entries to %s", kind, reflect.ValueOf(snap).Len(), c.OutPath)
+	return nil
+}
+
+func (c *cmdConfig) images(ctx context.Context) (ImagesSnapshot, error) {
 	pods, err := c.clientset.CoreV1().Pods(c.Namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to list pods: %v", err)
+		return nil, fmt.Errorf("failed to list pods: %v", err)
 	}
 
 	images := ImagesSnapshot{}
@@ -69,7 +112,7 @@ func (c *cmdConfig) RunImages(ctx context.Context) error {
 
 			ref, err := name.ParseReference(c.Image)
 			if err != nil {
-				return fmt.Errorf("failed to parse image reference: %v", err)
+				return nil, fmt.Errorf("failed to parse image reference: %v", err)
 			}
 
 			images[ref.Context().String()] = ImageSnapshot{
@@ -81,19 +124,22 @@ func (c *cmdConfig) RunImages(ctx context.Context) error {
 		}
 	}
 
-	f, err := os.Create(c.OutPath)
+	return images, nil
+}
+
+func writeSnapshot(path string, snapshot any) error {
+	f, err := os.Create(path)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", c.OutPath, err)
+		return fmt.Errorf("failed to create file %s: %v", path, err)
 	}
 	defer f.Close()
 
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
-	if err := enc.Encode(images); err != nil {
+	if err := enc.Encode(snapshot); err != nil {
 		return fmt.Errorf("failed to encode json: %v", err)
 	}
 
-	clog.InfoContextf(ctx, "images: %v", images)
 	return nil
 }
 
@@ -0,0 +1,327 @@
+package ksnap
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// Helm stores each release revision in a secret of this type, named
+	// with this prefix, the release name and the revision.
+	helmReleaseSecretType   = corev1.SecretType("helm.sh/release.v1")
+	helmReleaseSecretPrefix = "sh.helm.release.v1."
+)
+
+// ResourcesSnapshot maps namespace/Kind to the sorted names of the
+// resources of that kind. Kinds with generated names, like pods and
+// replica sets, are left out, as are the secrets Helm writes for every
+// release revision and service account tokens.
+type ResourcesSnapshot map[string][]string
+
+// RBACSnapshot maps Kind/namespace/name to a role's rules.
+type RBACSnapshot map[string]RoleSnapshot
+
+type RoleSnapshot struct {
+	Kind      string              `json:"kind"`
+	Namespace string              `json:"namespace,omitempty"`
+	Name      string              `json:"name"`
+	Rules     []rbacv1.PolicyRule `json:"rules"`
+}
+
+// PortsSnapshot maps namespace/Kind/name of services and workloads to the
+// ports they expose.
+type PortsSnapshot map[string]PortSnapshot
+
+type PortSnapshot struct {
+	// Service ports as port/protocol->targetPort, prefixed by their name
+	Service []string `json:"service,omitempty"`
+	// Container ports as port/protocol by container, prefixed by their name
+	Containers map[string][]string `json:"containers,omitempty"`
+}
+
+// SecuritySnapshot maps namespace/Kind/name of workloads to the security
+// settings of their pods.
+type SecuritySnapshot map[string]SecurityContextSnapshot
+
+type SecurityContextSnapshot struct {
+	Pod        *corev1.PodSecurityContext         `json:"pod,omitempty"`
+	Containers map[string]*corev1.SecurityContext `json:"containers"`
+}
+
+func (c *cmdConfig) resources(ctx context.Context) (ResourcesSnapshot, error) {
+	cs, ns, opts := c.clientset, c.Namespace, metav1.ListOptions{}
+
+	lists := []struct {
+		kind string
+		list func() (runtime.Object, error)
+	}{
+		{"ConfigMap", func() (runtime.Object, error) { return cs.CoreV1().ConfigMaps(ns).List(ctx, opts) }},
+		{"Secret", func() (runtime.Object, error) { return cs.CoreV1().Secrets(ns).List(ctx, opts) }},
+		{"Service", func() (runtime.Object, error) { return cs.CoreV1().Services(ns).List(ctx, opts) }},
+		{"ServiceAccount", func() (runtime.Object, error) { return cs.CoreV1().ServiceAccounts(ns).List(ctx, opts) }},
+		{"PersistentVolumeClaim", func() (runtime.Object, error) { return cs.CoreV1().PersistentVolumeClaims(ns).List(ctx, opts) }},
+		{"Deployment", func() (runtime.Object, error) { return cs.AppsV1().Deployments(ns).List(ctx, opts) }},
+		{"StatefulSet", func() (runtime.Object, error) { return cs.AppsV1().StatefulSets(ns).List(ctx, opts) }},
+		{"DaemonSet", func() (runtime.Object, error) { return cs.AppsV1().DaemonSets(ns).List(ctx, opts) }},
+		{"CronJob", func() (runtime.Object, error) { return cs.BatchV1().CronJobs(ns).List(ctx, opts) }},
+		{"Ingress", func() (runtime.Object, error) { return cs.NetworkingV1().Ingresses(ns).List(ctx, opts) }},
+		{"NetworkPolicy", func() (runtime.Object, error) { return cs.NetworkingV1().NetworkPolicies(ns).List(ctx, opts) }},
+		{"Role", func() (runtime.Object, error) { return cs.RbacV1().Roles(ns).List(ctx, opts) }},
+		{"RoleBinding", func() (runtime.Object, error) { return cs.RbacV1().RoleBindings(ns).List(ctx, opts) }},
+	}
+
+	snap := ResourcesSnapshot{}
+	for _, l := range lists {
+		list, err := l.list()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", l.kind, err)
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s list: %v", l.kind, err)
+		}
+
+		for _, item := range items {
+			if generatedSecret(item) {
+				continue
+			}
+			m, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			key := m.GetNamespace() + "/" + l.kind
+			snap[key] = append(snap[key], m.GetName())
+		}
+	}
+
+	for _, names := range snap {
+		slices.Sort(names)
+	}
+
+	return snap, nil
+}
+
+// generatedSecret reports whether obj is a secret that changes with every
+// Helm upgrade or service account rather than with the chart.
+func generatedSecret(obj runtime.Object) bool {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return false
+	}
+	return secret.Type == corev1.SecretTypeServiceAccountToken ||
+		secret.Type == helmReleaseSecretType ||
+		strings.HasPrefix(secret.Name, helmReleaseSecretPrefix)
+}
+
+// rbac snapshots the roles in the namespace and the cluster roles bound to
+// anything in it, or every role with no namespace.
+func (c *cmdConfig) rbac(ctx context.Context) (RBACSnapshot, error) {
+	rbac := c.clientset.RbacV1()
+
+	roles, err := rbac.Roles(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %v", err)
+	}
+
+	snap := RBACSnapshot{}
+	for _, r := range roles.Items {
+		snap["Role/"+r.Namespace+"/"+r.Name] = RoleSnapshot{Kind: "Role", Namespace: r.Namespace, Name: r.Name, Rules: sortRules(r.Rules)}
+	}
+
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cluster roles: %v", err)
+	}
+
+	bound := map[string]bool{}
+	if c.Namespace != "" {
+		bindings, err := rbac.RoleBindings(c.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list role bindings: %v", err)
+		}
+		for _, b := range bindings.Items {
+			if b.RoleRef.Kind == "ClusterRole" {
+				bound[b.RoleRef.Name] = true
+			}
+		}
+
+		clusterBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cluster role bindings: %v", err)
+		}
+		for _, b := range clusterBindings.Items {
+			if slices.ContainsFunc(b.Subjects, func(s rbacv1.Subject) bool { return s.Namespace == c.Namespace }) {
+				bound[b.RoleRef.Name] = true
+			}
+		}
+	}
+
+	for _, r := range clusterRoles.Items {
+		if c.Namespace != "" && !bound[r.Name] {
+			continue
+		}
+		snap["ClusterRole/"+r.Name] = RoleSnapshot{Kind: "ClusterRole", Name: r.Name, Rules: sortRules(r.Rules)}
+	}
+
+	return snap, nil
+}
+
+func (c *cmdConfig) ports(ctx context.Context) (PortsSnapshot, error) {
+	services, err := c.clientset.CoreV1().Services(c.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %v", err)
+	}
+
+	snap := PortsSnapshot{}
+	for _, svc := range services.Items {
+		ports := []string{}
+		for _, p := range svc.Spec.Ports {
+			ports = append(ports, named(p.Name, fmt.Sprintf("%d/%s->%s", p.Port, p.Protocol, p.TargetPort.String())))
+		}
+		slices.Sort(ports)
+		snap[svc.Namespace+"/Service/"+svc.Name] = PortSnapshot{Service: ports}
+	}
+
+	workloads, err := c.workloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range workloads {
+		containers := map[string][]string{}
+		for _, ct := range slices.Concat(w.spec.InitContainers, w.spec.Containers) {
+			for _, p := range ct.Ports {
+				containers[ct.Name] = append(containers[ct.Name], named(p.Name, fmt.Sprintf("%d/%s", p.ContainerPort, p.Protocol)))
+			}
+			slices.Sort(containers[ct.Name])
+		}
+		if len(containers) > 0 {
+			snap[w.key] = PortSnapshot{Containers: containers}
+		}
+	}
+
+	return snap, nil
+}
+
+func (c *cmdConfig) security(ctx context.Context) (SecuritySnapshot, error) {
+	workloads, err := c.workloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := SecuritySnapshot{}
+	for _, w := range workloads {
+		s := SecurityContextSnapshot{Pod: w.spec.SecurityContext, Containers: map[string]*corev1.SecurityContext{}}
+		for _, ct := range slices.Concat(w.spec.InitContainers, w.spec.Containers) {
+			sc := ct.SecurityContext
+			if sc != nil && sc.Capabilities != nil {
+				sc = sc.DeepCopy()
+				slices.Sort(sc.Capabilities.Add)
+				slices.Sort(sc.Capabilities.Drop)
+			}
+			s.Containers[ct.Name] = sc
+		}
+		snap[w.key] = s
+	}
+
+	return snap, nil
+}
+
+// workload is the pod template of a workload, keyed by namespace/Kind/name.
+type workload struct {
+	key  string
+	spec corev1.PodSpec
+}
+
+// workloads lists the pod templates of deployments, stateful sets, daemon
+// sets, cron jobs and the jobs no cron job owns.
+func (c *cmdConfig) workloads(ctx context.Context) ([]workload, error) {
+	cs, ns, opts := c.clientset, c.Namespace, metav1.ListOptions{}
+	key := func(kind string, m metav1.ObjectMeta) string {
+		return m.Namespace + "/" + kind + "/" + m.Name
+	}
+
+	workloads := []workload{}
+
+	deployments, err := cs.AppsV1().Deployments(ns).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %v", err)
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, workload{key("Deployment", d.ObjectMeta), d.Spec.Template.Spec})
+	}
+
+	statefulSets, err := cs.AppsV1().StatefulSets(ns).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stateful sets: %v", err)
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, workload{key("StatefulSet", s.ObjectMeta), s.Spec.Template.Spec})
+	}
+
+	daemonSets, err := cs.AppsV1().DaemonSets(ns).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemon sets: %v", err)
+	}
+	for _, d := range daemonSets.Items {
+		workloads = append(workloads, workload{key("DaemonSet", d.ObjectMeta), d.Spec.Template.Spec})
+	}
+
+	cronJobs, err := cs.BatchV1().CronJobs(ns).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cron jobs: %v", err)
+	}
+	for _, cj := range cronJobs.Items {
+		workloads = append(workloads, workload{key("CronJob", cj.ObjectMeta), cj.Spec.JobTemplate.Spec.Template.Spec})
+	}
+
+	jobs, err := cs.BatchV1().Jobs(ns).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %v", err)
+	}
+	for _, j := range jobs.Items {
+		if metav1.GetControllerOf(&j) != nil {
+			continue
+		}
+		workloads = append(workloads, workload{key("Job", j.ObjectMeta), j.Spec.Template.Spec})
+	}
+
+	return workloads, nil
+}
+
+// sortRules sorts the rules and every list in them, so reordering them
+// doesn't show up as drift.
+func sortRules(rules []rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	sorted := make([]rbacv1.PolicyRule, 0, len(rules))
+	for _, r := range rules {
+		r = *r.DeepCopy()
+		slices.Sort(r.APIGroups)
+		slices.Sort(r.Resources)
+		slices.Sort(r.ResourceNames)
+		slices.Sort(r.Verbs)
+		slices.Sort(r.NonResourceURLs)
+		sorted = append(sorted, r)
+	}
+
+	slices.SortFunc(sorted, func(a, b rbacv1.PolicyRule) int {
+		return strings.Compare(compact(a), compact(b))
+	})
+
+	return sorted
+}
+
+func named(name, port string) string {
+	if name == "" {
+		return port
+	}
+	return name + ": " + port
+}
@@ -0,0 +1,190 @@
+package ksnap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func objectMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Namespace: "web", Name: name}
+}
+
+func deployment(name string, spec corev1.PodSpec) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: objectMeta(name),
+		Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: spec}},
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func newConfig(objects ...runtime.Object) *cmdConfig {
+	return &cmdConfig{Namespace: "web", clientset: fake.NewClientset(objects...)}
+}
+
+func TestResources(t *testing.T) {
+	c := newConfig(
+		&corev1.ConfigMap{ObjectMeta: objectMeta("nginx-conf")},
+		&corev1.Secret{ObjectMeta: objectMeta("tls"), Type: corev1.SecretTypeTLS},
+		&corev1.Secret{ObjectMeta: objectMeta("api-key"), Type: corev1.SecretTypeOpaque},
+		&corev1.Secret{ObjectMeta: objectMeta("sh.helm.release.v1.web.v3"), Type: helmReleaseSecretType},
+		&corev1.Secret{ObjectMeta: objectMeta("sh.helm.release.v1.web.v4")},
+		&corev1.Secret{ObjectMeta: objectMeta("default-token-x7k2p"), Type: corev1.SecretTypeServiceAccountToken},
+		&corev1.ServiceAccount{ObjectMeta: objectMeta("default")},
+		deployment("nginx", corev1.PodSpec{}),
+		&corev1.Pod{ObjectMeta: objectMeta("nginx-6d4cf56db6-9xk2p")},
+	)
+
+	snap, err := c.resources(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, ResourcesSnapshot{
+		"web/ConfigMap":      {"nginx-conf"},
+		"web/Secret":         {"api-key", "tls"},
+		"web/ServiceAccount": {"default"},
+		"web/Deployment":     {"nginx"},
+	}, snap)
+}
+
+func TestSortRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []rbacv1.PolicyRule
+		want  []rbacv1.PolicyRule
+	}{{
+		name:  "empty",
+		rules: nil,
+		want:  []rbacv1.PolicyRule{},
+	}, {
+		name: "lists",
+		rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{"apps", ""},
+			Resources: []string{"pods", "deployments"},
+			Verbs:     []string{"watch", "get", "list"},
+		}},
+		want: []rbacv1.PolicyRule{{
+			APIGroups: []string{"", "apps"},
+			Resources: []string{"deployments", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		}},
+	}, {
+		name: "rules",
+		rules: []rbacv1.PolicyRule{
+			{NonResourceURLs: []string{"/metrics", "/healthz"}, Verbs: []string{"get"}},
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"tls", "api-key"}, Verbs: []string{"get"}},
+		},
+		want: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"api-key", "tls"}, Verbs: []string{"get"}},
+			{NonResourceURLs: []string{"/healthz", "/metrics"}, Verbs: []string{"get"}},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, sortRules(tt.rules))
+		})
+	}
+
+	rules := []rbacv1.PolicyRule{{Verbs: []string{"list", "get"}}}
+	sortRules(rules)
+	require.Equal(t, []string{"list", "get"}, rules[0].Verbs, "the rules are sorted in a copy")
+}
+
+func TestPorts(t *testing.T) {
+	c := newConfig(
+		&corev1.Service{
+			ObjectMeta: objectMeta("nginx"),
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromString("https")},
+				{Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt32(8080)},
+			}},
+		},
+		deployment("nginx", corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "setup"}},
+			Containers: []corev1.Container{{
+				Name: "nginx",
+				Ports: []corev1.ContainerPort{
+					{Name: "https", ContainerPort: 8443, Protocol: corev1.ProtocolTCP},
+					{ContainerPort: 8080, Protocol: corev1.ProtocolTCP},
+				},
+			}},
+		}),
+		deployment("worker", corev1.PodSpec{Containers: []corev1.Container{{Name: "worker"}}}),
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "web",
+				Name:            "backup-29000000",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", Name: "backup", Controller: boolPtr(true)}},
+			},
+			Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "backup", Ports: []corev1.ContainerPort{{ContainerPort: 9000}}}},
+			}}},
+		},
+	)
+
+	snap, err := c.ports(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, PortsSnapshot{
+		"web/Service/nginx": {Service: []string{"80/TCP->8080", "https: 443/TCP->https"}},
+		"web/Deployment/nginx": {Containers: map[string][]string{
+			"nginx": {"8080/TCP", "https: 8443/TCP"},
+		}},
+	}, snap)
+}
+
+func TestSecurity(t *testing.T) {
+	caps := &corev1.Capabilities{
+		Add:  []corev1.Capability{"NET_BIND_SERVICE", "CHOWN"},
+		Drop: []corev1.Capability{"NET_RAW", "ALL"},
+	}
+	c := newConfig(
+		deployment("nginx", corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true)},
+			InitContainers:  []corev1.Container{{Name: "setup"}},
+			Containers: []corev1.Container{{
+				Name:            "nginx",
+				SecurityContext: &corev1.SecurityContext{Capabilities: caps, ReadOnlyRootFilesystem: boolPtr(true)},
+			}},
+		}),
+		&appsv1.DaemonSet{
+			ObjectMeta: objectMeta("agent"),
+			Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "agent", SecurityContext: &corev1.SecurityContext{Privileged: boolPtr(true)}}},
+			}}},
+		},
+	)
+
+	snap, err := c.security(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, SecuritySnapshot{
+		"web/Deployment/nginx": {
+			Pod: &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true)},
+			Containers: map[string]*corev1.SecurityContext{
+				"setup": nil,
+				"nginx": {
+					Capabilities: &corev1.Capabilities{
+						Add:  []corev1.Capability{"CHOWN", "NET_BIND_SERVICE"},
+						Drop: []corev1.Capability{"ALL", "NET_RAW"},
+					},
+					ReadOnlyRootFilesystem: boolPtr(true),
+				},
+			},
+		},
+		"web/DaemonSet/agent": {
+			Containers: map[string]*corev1.SecurityContext{
+				"agent": {Privileged: boolPtr(true)},
+			},
+		},
+	}, snap)
+}
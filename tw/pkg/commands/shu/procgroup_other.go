@@ -0,0 +1,35 @@
+//go:build !unix
+// +build !unix
+
+package shu
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup is a no-op where process groups aren't supported.
+func setProcessGroup(_ *exec.Cmd) {}
+
+// signalProcessGroup falls back to signalling c's process alone.
+func signalProcessGroup(c *exec.Cmd, sig os.Signal) error {
+	return c.Process.Signal(sig)
+}
+
+// parseSignal only knows the handful of signals available everywhere.
+func parseSignal(s string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(s), "SIG") {
+	case "HUP", "1":
+		return syscall.SIGHUP, nil
+	case "INT", "2":
+		return syscall.SIGINT, nil
+	case "KILL", "9":
+		return syscall.SIGKILL, nil
+	case "TERM", "15":
+		return syscall.SIGTERM, nil
+	}
+	return 0, fmt.Errorf("unknown signal %q", s)
+}
@@ -1,11 +1,16 @@
 package shu
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"regexp"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -19,9 +24,21 @@ type retryCfg struct {
 	Attempts int
 	Delay    time.Duration
 	Timeout  time.Duration
+	// AttemptTimeout bounds a single attempt, a hung attempt is killed and
+	// retried while Timeout still bounds the whole loop.
+	AttemptTimeout time.Duration
+	MaxDelay       time.Duration
+	Jitter         time.Duration
 	// InBash indicates whether the passed command should be run inside Bash.
 	InBash     bool
 	FixedDelay bool
+	// RetryOnExit and RetryIfOutput restrict retries to the listed exit codes
+	// or to attempts whose output matches; NoRetryOnExit always fails fast.
+	RetryOnExit   []int
+	NoRetryOnExit []int
+	RetryIfOutput string
+
+	retryIfOutput *regexp.Regexp
 }
 
 func retryCommand() *cobra.Command {
@@ -33,6 +50,18 @@ func retryCommand() *cobra.Command {
   retry -a 5 -- curl http://localhost:8080/healthz
 
   retry -a 5 -b -- "[ $((RANDOM % 5)) -eq 0 ] && exit 0 || exit 10"
+
+  # Only retry on EX_TEMPFAIL or when curl reports a refused connection
+  retry -a 5 --retry-on-exit 75 --retry-if-output 'Connection refused' -- curl -sf http://localhost:8080/
+
+  # Kill attempts that hang for more than 30s and cap the backoff at 10s
+  retry -a 10 --attempt-timeout 30s --max-delay 10s --jitter 500ms -- ./flaky-download.sh
+
+  # Vary behavior per attempt
+  retry -a 3 -b -- 'echo "attempt $SHU_ATTEMPT of $SHU_MAX_ATTEMPTS"'
+
+  # Never retry usage errors
+  retry -a 5 --no-retry-on-exit 2 -- ./run-tests.sh
 		`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cfg.Run(cmd, args)
@@ -42,8 +71,14 @@ func retryCommand() *cobra.Command {
 	cmd.Flags().IntVarP(&cfg.Attempts, "attempts", "a", 1, "Number of times to retry")
 	cmd.Flags().DurationVarP(&cfg.Delay, "delay", "d", 1*time.Second, "Delay between attempts")
 	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", 5*time.Minute, "Timeout for the command")
+	cmd.Flags().DurationVar(&cfg.AttemptTimeout, "attempt-timeout", 0, "Timeout for a single attempt, after which it is killed and retried (0 for no timeout)")
+	cmd.Flags().DurationVar(&cfg.MaxDelay, "max-delay", 0, "Maximum delay between attempts (0 for no maximum)")
+	cmd.Flags().DurationVar(&cfg.Jitter, "jitter", 0, "Maximum random jitter added to the delay between attempts")
 	cmd.Flags().BoolVarP(&cfg.InBash, "in-bash", "b", false, "Run the passed Bash inside a Bash shell")
 	cmd.Flags().BoolVarP(&cfg.FixedDelay, "fixed-delay", "f", false, "Use fixed delay between retries (default is exponential backoff)")
+	cmd.Flags().IntSliceVar(&cfg.RetryOnExit, "retry-on-exit", nil, "Only retry when the command exits with one of these codes")
+	cmd.Flags().IntSliceVar(&cfg.NoRetryOnExit, "no-retry-on-exit", nil, "Never retry when the command exits with one of these codes")
+	cmd.Flags().StringVar(&cfg.RetryIfOutput, "retry-if-output", "", "Only retry when the command's stdout or stderr matches this regular expression")
 
 	return cmd
 }
@@ -55,6 +90,14 @@ func (c *retryCfg) Run(cmd *cobra.Command, args []string) error {
 
 	rawcmd := strings.Join(args, " ")
 
+	if c.RetryIfOutput != "" {
+		re, err := regexp.Compile(c.RetryIfOutput)
+		if err != nil {
+			return fmt.Errorf("failed to compile --retry-if-output %q: %v", c.RetryIfOutput, err)
+		}
+		c.retryIfOutput = re
+	}
+
 	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
@@ -69,13 +112,37 @@ func (c *retryCfg) Run(cmd *cobra.Command, args []string) error {
 		retry.OnRetry(func(attempt uint, err error) {
 			l.ErrorContextf(ctx, "[%d/%d] command failed, retrying: %s", attempt, c.Attempts, err)
 		}),
+		retry.RetryIf(func(err error) bool {
+			if c.shouldRetry(err) {
+				return true
+			}
+			l.ErrorContextf(ctx, "command failed with a non-retryable error: %s", err)
+			return false
+		}),
 		retry.Context(ctx),
 		retry.Attempts(uint(c.Attempts)),
 		retry.Delay(c.Delay),
 	}
 
+	if c.MaxDelay > 0 {
+		retryOpts = append(retryOpts, retry.MaxDelay(c.MaxDelay))
+	}
+
+	delayType := retry.BackOffDelay
 	if c.FixedDelay {
-		retryOpts = append(retryOpts, retry.DelayType(retry.FixedDelay))
+		delayType = retry.FixedDelay
+	}
+
+	// Without --jitter keep the library defaults: exponential backoff comes
+	// with up to 100ms of jitter and fixed delays come with none.
+	switch {
+	case c.Jitter > 0:
+		retryOpts = append(retryOpts,
+			retry.MaxJitter(c.Jitter),
+			retry.DelayType(retry.CombineDelay(delayType, retry.RandomDelay)),
+		)
+	case c.FixedDelay:
+		retryOpts = append(retryOpts, retry.DelayType(delayType))
 	}
 
 	err := retry.Do(
@@ -83,13 +150,37 @@ func (c *retryCfg) Run(cmd *cobra.Command, args []string) error {
 			attempt++
 			l.InfoContextf(ctx, "[%d/%d] attempting command", attempt, c.Attempts)
 
-			command := newCommand(ctx, c.InBash, args)
+			actx := ctx
+			if c.AttemptTimeout > 0 {
+				var acancel context.CancelFunc
+				actx, acancel = context.WithTimeout(ctx, c.AttemptTimeout)
+				defer acancel()
+			}
+
+			command := newCommand(actx, c.InBash, args)
+			// Don't wait on children that outlive a timed out attempt and
+			// hold its output open
+			command.WaitDelay = time.Second
 			command.Stdout = cmd.OutOrStdout()
 			command.Stderr = cmd.ErrOrStderr()
-			command.Env = os.Environ()
+			command.Env = append(os.Environ(),
+				fmt.Sprintf("SHU_ATTEMPT=%d", attempt),
+				fmt.Sprintf("SHU_MAX_ATTEMPTS=%d", c.Attempts),
+			)
+
+			// Only tee the output when it's needed to decide on a retry
+			var output bytes.Buffer
+			if c.retryIfOutput != nil {
+				command.Stdout = io.MultiWriter(command.Stdout, &output)
+				command.Stderr = io.MultiWriter(command.Stderr, &output)
+			}
 
 			if err := command.Run(); err != nil {
-				return err
+				// Only the attempt's own deadline counts, not the overall --timeout
+				if ctx.Err() == nil && errors.Is(actx.Err(), context.DeadlineExceeded) {
+					return &attemptError{err: fmt.Errorf("attempt timed out after %s: %w", c.AttemptTimeout, err), timedOut: true}
+				}
+				return &attemptError{err: err, output: output.Bytes()}
 			}
 
 			return nil
@@ -100,6 +191,56 @@ func (c *retryCfg) Run(cmd *cobra.Command, args []string) error {
 	return err
 }
 
+// shouldRetry decides whether a failed attempt is worth retrying. Hung
+// attempts are always retried. Otherwise the positive selectors are OR'd
+// together, and --no-retry-on-exit wins over both of them.
+func (c *retryCfg) shouldRetry(err error) bool {
+	var aerr *attemptError
+	if !errors.As(err, &aerr) || aerr.timedOut {
+		return true
+	}
+
+	code := aerr.exitCode()
+	if slices.Contains(c.NoRetryOnExit, code) {
+		return false
+	}
+
+	if len(c.RetryOnExit) == 0 && c.retryIfOutput == nil {
+		return true
+	}
+
+	if slices.Contains(c.RetryOnExit, code) {
+		return true
+	}
+
+	return c.retryIfOutput != nil && c.retryIfOutput.Match(aerr.output)
+}
+
+// attemptError is a failed attempt along with the output it produced.
+type attemptError struct {
+	err      error
+	output   []byte
+	timedOut bool
+}
+
+func (e *attemptError) Error() string {
+	return e.err.Error()
+}
+
+func (e *attemptError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the attempt's exit code, or -1 if the command didn't
+// exit normally (e.g. it couldn't be started or was killed by a signal).
+func (e *attemptError) exitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
 func newCommand(ctx context.Context, inShell bool, args []string) *exec.Cmd {
 	var c *exec.Cmd
 	if inShell {
@@ -4,7 +4,12 @@ import (
 	"context"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -96,3 +101,160 @@ func TestRetryRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryConditions(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          retryCfg
+		script       string
+		wantAttempts int
+	}{
+		{
+			name:         "retries any failure by default",
+			cfg:          retryCfg{},
+			script:       "exit 2",
+			wantAttempts: 3,
+		},
+		{
+			name:         "retry on listed exit code",
+			cfg:          retryCfg{RetryOnExit: []int{75, 111}},
+			script:       "exit 75",
+			wantAttempts: 3,
+		},
+		{
+			name:         "fail fast on unlisted exit code",
+			cfg:          retryCfg{RetryOnExit: []int{75, 111}},
+			script:       "exit 1",
+			wantAttempts: 1,
+		},
+		{
+			name:         "no-retry-on-exit fails fast",
+			cfg:          retryCfg{NoRetryOnExit: []int{2}},
+			script:       "exit 2",
+			wantAttempts: 1,
+		},
+		{
+			name:         "no-retry-on-exit wins over retry-on-exit",
+			cfg:          retryCfg{RetryOnExit: []int{2}, NoRetryOnExit: []int{2}},
+			script:       "exit 2",
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry when output matches",
+			cfg:          retryCfg{RetryIfOutput: "(?i)try again"},
+			script:       "echo 'Resource busy, try again' >&2; exit 1",
+			wantAttempts: 3,
+		},
+		{
+			name:         "fail fast when output does not match",
+			cfg:          retryCfg{RetryIfOutput: "(?i)try again"},
+			script:       "echo 'assertion failed'; exit 1",
+			wantAttempts: 1,
+		},
+		{
+			name:         "exit code or output selects a retry",
+			cfg:          retryCfg{RetryOnExit: []int{75}, RetryIfOutput: "refused"},
+			script:       "echo 'connection refused'; exit 7",
+			wantAttempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := filepath.Join(t.TempDir(), "attempts")
+
+			tt.cfg.Attempts = 3
+			tt.cfg.Delay = 1 * time.Millisecond
+			tt.cfg.Timeout = 5 * time.Second
+			tt.cfg.InBash = true
+
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			err := tt.cfg.Run(cmd, []string{"echo x >> " + counter + "; " + tt.script})
+			require.Error(t, err)
+
+			data, err := os.ReadFile(counter)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantAttempts, strings.Count(string(data), "x"))
+		})
+	}
+}
+
+func TestRetryAttemptTimeout(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "attempts")
+
+	// The first attempt hangs and is killed, the second one succeeds
+	cfg := retryCfg{
+		Attempts:       3,
+		Delay:          1 * time.Millisecond,
+		Timeout:        10 * time.Second,
+		AttemptTimeout: 200 * time.Millisecond,
+		InBash:         true,
+		RetryOnExit:    []int{75},
+	}
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+
+	start := time.Now()
+	err := cfg.Run(cmd, []string{"echo x >> " + counter + `; [ "$SHU_ATTEMPT" -gt 1 ] || exec sleep 30`})
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	data, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(data), "x"))
+}
+
+func TestRetryAttemptTimeoutBackgroundChild(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "attempts")
+
+	// The first attempt leaves a sleep behind that holds the output pipe
+	// --retry-if-output reads from open long after the attempt is killed
+	cfg := retryCfg{
+		Attempts:       3,
+		Delay:          1 * time.Millisecond,
+		Timeout:        30 * time.Second,
+		AttemptTimeout: 200 * time.Millisecond,
+		InBash:         true,
+		retryIfOutput:  regexp.MustCompile("never"),
+	}
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	start := time.Now()
+	err := cfg.Run(cmd, []string{"echo x >> " + counter + `; [ "$SHU_ATTEMPT" -gt 1 ] || { sleep 20 & sleep 20; }`})
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	data, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(data), "x"))
+}
+
+func TestRetryAttemptEnv(t *testing.T) {
+	var out strings.Builder
+	cfg := retryCfg{
+		Attempts:   3,
+		Delay:      1 * time.Millisecond,
+		Timeout:    5 * time.Second,
+		MaxDelay:   5 * time.Millisecond,
+		Jitter:     1 * time.Millisecond,
+		InBash:     true,
+		FixedDelay: true,
+	}
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	cmd.SetOut(&out)
+
+	err := cfg.Run(cmd, []string{`echo "$SHU_ATTEMPT/$SHU_MAX_ATTEMPTS"; [ "$SHU_ATTEMPT" -eq 3 ]`})
+	require.NoError(t, err)
+	require.Equal(t, "1/3\n2/3\n3/3\n", out.String())
+}
@@ -19,6 +19,9 @@ func Command() *cobra.Command {
 	cmd.AddCommand(
 		retryCommand(),
 		waitCommand(),
+		untilCommand(),
+		superviseCommand(),
+		timeoutCommand(),
 	)
 
 	return cmd
@@ -27,3 +30,18 @@ func Command() *cobra.Command {
 func (c *cfg) Run(cmd *cobra.Command, args []string) error {
 	return nil
 }
+
+// ExitCodeError is returned by subcommands that must exit with a specific
+// status, such as the status of the command they wrapped.
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
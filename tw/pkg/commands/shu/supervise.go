@@ -0,0 +1,269 @@
+package shu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type superviseCfg struct {
+	ReadyTCP     []string
+	ReadyHTTP    []string
+	ReadyFile    []string
+	ReadyUnix    []string
+	ReadyExec    []string
+	ReadyTimeout time.Duration
+	Interval     time.Duration
+	Log          string
+	GracePeriod  time.Duration
+}
+
+func superviseCommand() *cobra.Command {
+	cfg := &superviseCfg{}
+
+	cmd := &cobra.Command{
+		Use:   "supervise [--ready-tcp host:port]... [--log FILE] -- <service> -- <test command>",
+		Short: "Run a service in the background for the lifetime of a test command",
+		Example: `
+  # Start a daemon, wait for its port, run the tests and stop the daemon
+  supervise --ready-tcp :8080 --log svc.log -- my-daemon --port 8080 -- curl -sf http://localhost:8080/
+
+  # Wait for an HTTP health check and give the service 30s to shut down
+  supervise --ready-http http://localhost:9090/-/ready --grace-period 30s -- prometheus -- ./test.sh
+		`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			// Without a readiness target the test would race the service
+			if len(cfg.ReadyTCP)+len(cfg.ReadyHTTP)+len(cfg.ReadyFile)+len(cfg.ReadyUnix)+len(cfg.ReadyExec) == 0 {
+				return fmt.Errorf("at least one of --ready-tcp, --ready-http, --ready-file, --ready-unix-socket or --ready-exec must be specified")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.Run(cmd, args)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&cfg.ReadyTCP, "ready-tcp", nil, "TCP target host:port the service is ready on (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.ReadyHTTP, "ready-http", nil, "HTTP(S) URL that returns 2xx once the service is ready (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.ReadyFile, "ready-file", nil, "File path that exists once the service is ready (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.ReadyUnix, "ready-unix-socket", nil, "Unix socket path the service is ready on (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.ReadyExec, "ready-exec", nil, "Command run in Bash that exits 0 once the service is ready (can be specified multiple times)")
+	cmd.Flags().DurationVar(&cfg.ReadyTimeout, "ready-timeout", 30*time.Second, "Timeout for the service to become ready")
+	cmd.Flags().DurationVarP(&cfg.Interval, "interval", "i", 1*time.Second, "Time between readiness checks")
+	cmd.Flags().StringVar(&cfg.Log, "log", "", "File to write the service's output to (kept in memory if unset)")
+	cmd.Flags().DurationVar(&cfg.GracePeriod, "grace-period", 10*time.Second, "Time to wait after SIGTERM before killing the service")
+
+	return cmd
+}
+
+func (c *superviseCfg) Run(cmd *cobra.Command, args []string) error {
+	svcArgs, testArgs, err := splitSuperviseArgs(args)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l := clog.FromContext(ctx).With("service", strings.Join(svcArgs, " "))
+
+	var svcLog bytes.Buffer
+	var svcOut io.Writer = &svcLog
+	if c.Log != "" {
+		f, err := os.Create(c.Log)
+		if err != nil {
+			return fmt.Errorf("failed to create log file %s: %v", c.Log, err)
+		}
+		defer f.Close()
+		svcOut = f
+	}
+
+	svc := exec.Command(svcArgs[0], svcArgs[1:]...)
+	svc.Stdout = svcOut
+	svc.Stderr = svcOut
+	svc.Env = os.Environ()
+	// Don't wait on children that leave the process group and hold the
+	// service's output open after it exits
+	svc.WaitDelay = time.Second
+	setProcessGroup(svc)
+
+	if err := svc.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %v", err)
+	}
+	l.InfoContext(ctx, "service started", "pid", svc.Process.Pid)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- svc.Wait()
+	}()
+
+	if err := c.waitReady(ctx, exited); err != nil {
+		c.stop(ctx, svc, exited)
+		c.dumpLog(cmd, &svcLog)
+		return err
+	}
+	l.InfoContext(ctx, "service is ready, running test command", "test", strings.Join(testArgs, " "))
+
+	test := exec.CommandContext(ctx, testArgs[0], testArgs[1:]...)
+	test.Stdout = cmd.OutOrStdout()
+	test.Stderr = cmd.ErrOrStderr()
+	test.Env = os.Environ()
+	testErr := test.Run()
+
+	svcErr := c.stop(ctx, svc, exited)
+
+	if testErr != nil {
+		c.dumpLog(cmd, &svcLog)
+
+		code := 1
+		var exitErr *exec.ExitError
+		if errors.As(testErr, &exitErr) && exitErr.ExitCode() > 0 {
+			code = exitErr.ExitCode()
+		}
+		return &ExitCodeError{Code: code, Err: fmt.Errorf("test command failed: %w", testErr)}
+	}
+
+	if svcErr != nil {
+		l.InfoContext(ctx, "service exited with an error after the test passed", "err", svcErr)
+	}
+
+	return nil
+}
+
+// waitReady blocks until every readiness target is up, failing early if
+// the service exits first.
+func (c *superviseCfg) waitReady(ctx context.Context, exited chan error) error {
+	wc := &waitCfg{
+		Interval:    c.Interval,
+		DialTimeout: 5 * time.Second,
+		TCPTargets:  c.ReadyTCP,
+		HTTPTargets: c.ReadyHTTP,
+		HTTPStatus:  "200-299",
+		FileTargets: c.ReadyFile,
+		UnixTargets: c.ReadyUnix,
+		ExecTargets: c.ReadyExec,
+	}
+
+	targets, err := wc.targets()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.ReadyTimeout)
+	defer cancel()
+
+	results := make([]waitResult, len(targets))
+	ready := make(chan struct{})
+	go func() {
+		var g errgroup.Group
+		for i, target := range targets {
+			t := target
+			g.Go(func() error {
+				results[i] = wc.poll(ctx, t)
+				return nil
+			})
+		}
+		_ = g.Wait()
+		close(ready)
+	}()
+
+	select {
+	case err := <-exited:
+		// Hand the result back for stop to observe
+		exited <- err
+		cancel()
+		<-ready
+		return fmt.Errorf("service exited before becoming ready: %v", err)
+	case <-ready:
+	}
+
+	notReady := []string{}
+	for _, r := range results {
+		if !r.Ready {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", r.Target, r.LastError))
+		}
+	}
+	if len(notReady) > 0 {
+		return fmt.Errorf("service did not become ready: %s", strings.Join(notReady, ", "))
+	}
+
+	return nil
+}
+
+// stop sends SIGTERM to the service's process group and escalates to
+// SIGKILL once the grace period is over. It returns the service's exit error.
+func (c *superviseCfg) stop(ctx context.Context, svc *exec.Cmd, exited chan error) error {
+	select {
+	case err := <-exited:
+		// Make sure nothing it spawned outlives it
+		_ = signalProcessGroup(svc, syscall.SIGKILL)
+		return err
+	default:
+	}
+
+	clog.InfoContext(ctx, "stopping service", "pid", svc.Process.Pid, "grace_period", c.GracePeriod)
+	_ = signalProcessGroup(svc, syscall.SIGTERM)
+
+	select {
+	case err := <-exited:
+		_ = signalProcessGroup(svc, syscall.SIGKILL)
+		return err
+	case <-time.After(c.GracePeriod):
+		clog.InfoContext(ctx, "service did not stop within the grace period, killing it", "pid", svc.Process.Pid)
+		_ = signalProcessGroup(svc, syscall.SIGKILL)
+		return <-exited
+	}
+}
+
+// dumpLog writes the service's output to stderr to help diagnose failures.
+func (c *superviseCfg) dumpLog(cmd *cobra.Command, buf *bytes.Buffer) {
+	out := buf.Bytes()
+	if c.Log != "" {
+		data, err := os.ReadFile(c.Log)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "failed to read service log %s: %v\n", c.Log, err)
+			return
+		}
+		out = data
+	}
+
+	w := cmd.ErrOrStderr()
+	fmt.Fprintln(w, "---- service log ----")
+	_, _ = w.Write(out)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "---- end service log ----")
+}
+
+// splitSuperviseArgs splits "<service> -- <test>", cobra already consumed
+// the leading "--".
+func splitSuperviseArgs(args []string) ([]string, []string, error) {
+	i := slices.Index(args, "--")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("expected '-- <service> -- <test command>'")
+	}
+
+	svcArgs, testArgs := args[:i], args[i+1:]
+	if len(svcArgs) == 0 {
+		return nil, nil, fmt.Errorf("no service command provided")
+	}
+	if len(testArgs) == 0 {
+		return nil, nil, fmt.Errorf("no test command provided")
+	}
+
+	return svcArgs, testArgs, nil
+}
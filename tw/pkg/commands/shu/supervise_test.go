@@ -0,0 +1,151 @@
+package shu
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSuperviseArgs(t *testing.T) {
+	svc, test, err := splitSuperviseArgs([]string{"daemon", "-p", "8080", "--", "curl", "--", "x"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"daemon", "-p", "8080"}, svc)
+	require.Equal(t, []string{"curl", "--", "x"}, test)
+
+	_, _, err = splitSuperviseArgs([]string{"daemon"})
+	require.ErrorContains(t, err, "expected")
+
+	_, _, err = splitSuperviseArgs([]string{"--", "test"})
+	require.ErrorContains(t, err, "no service command")
+
+	_, _, err = splitSuperviseArgs([]string{"daemon", "--"})
+	require.ErrorContains(t, err, "no test command")
+}
+
+func TestSuperviseRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		service    string
+		test       string
+		grace      time.Duration
+		wantCode   int
+		wantErr    string
+		wantLog    bool
+		maxRuntime time.Duration
+	}{
+		{
+			name:    "service ready and test passes",
+			service: `echo starting; sleep 0.1; touch ready; exec sleep 30`,
+			test:    `test -f ready`,
+		},
+		{
+			name:     "test failure passes through its status",
+			service:  `echo starting; touch ready; exec sleep 30`,
+			test:     `exit 3`,
+			wantCode: 3,
+			wantErr:  "test command failed",
+			wantLog:  true,
+		},
+		{
+			name:    "service exits before ready",
+			service: `echo starting; exit 1`,
+			test:    `true`,
+			wantErr: "service exited before becoming ready",
+			wantLog: true,
+		},
+		{
+			name:       "service ignoring SIGTERM is killed after the grace period",
+			service:    `trap '' TERM; touch ready; sleep 30`,
+			test:       `true`,
+			grace:      100 * time.Millisecond,
+			maxRuntime: 5 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Chdir(dir)
+
+			cfg := &superviseCfg{
+				ReadyFile:    []string{filepath.Join(dir, "ready")},
+				ReadyTimeout: 5 * time.Second,
+				Interval:     10 * time.Millisecond,
+				Log:          filepath.Join(dir, "svc.log"),
+				GracePeriod:  5 * time.Second,
+			}
+			if tt.grace > 0 {
+				cfg.GracePeriod = tt.grace
+			}
+
+			var stderr strings.Builder
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+			cmd.SetErr(&stderr)
+
+			start := time.Now()
+			err := cfg.Run(cmd, []string{"bash", "-c", tt.service, "--", "bash", "-c", tt.test})
+			if tt.maxRuntime > 0 {
+				require.Less(t, time.Since(start), tt.maxRuntime)
+			}
+
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+
+			if tt.wantCode != 0 {
+				var ec *ExitCodeError
+				require.True(t, errors.As(err, &ec))
+				require.Equal(t, tt.wantCode, ec.Code)
+			}
+
+			if tt.wantLog {
+				require.Contains(t, stderr.String(), "---- service log ----\nstarting\n")
+			} else {
+				require.NotContains(t, stderr.String(), "service log")
+			}
+		})
+	}
+}
+
+func TestSuperviseServiceChildHoldsOutput(t *testing.T) {
+	dir := t.TempDir()
+
+	// The service's output is kept in memory, so a child that escapes its
+	// process group holds the pipe open after the service exits
+	cfg := &superviseCfg{
+		ReadyFile:    []string{filepath.Join(dir, "ready")},
+		ReadyTimeout: 10 * time.Second,
+		Interval:     10 * time.Millisecond,
+		GracePeriod:  5 * time.Second,
+	}
+
+	var stderr strings.Builder
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	cmd.SetErr(&stderr)
+
+	start := time.Now()
+	err := cfg.Run(cmd, []string{"bash", "-c", "echo starting; setsid sleep 20 & exit 1", "--", "true"})
+	require.ErrorContains(t, err, "service exited before becoming ready")
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Contains(t, stderr.String(), "---- service log ----\nstarting\n")
+}
+
+func TestSuperviseRequiresReadyTarget(t *testing.T) {
+	cmd := superviseCommand()
+	cmd.SetArgs([]string{"--", "true", "--", "true"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	require.EqualError(t, cmd.Execute(), "at least one of --ready-tcp, --ready-http, --ready-file, --ready-unix-socket or --ready-exec must be specified")
+}
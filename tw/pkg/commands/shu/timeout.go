@@ -0,0 +1,211 @@
+package shu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes match coreutils timeout.
+const (
+	exitTimedOut    = 124
+	exitFailed      = 125
+	exitCannotRun   = 126
+	exitNotFound    = 127
+	exitSignalBase  = 128
+	exitKilledAfter = exitSignalBase + int(syscall.SIGKILL)
+)
+
+type timeoutCfg struct {
+	Signal         string
+	KillAfter      time.Duration
+	PreserveStatus bool
+}
+
+func timeoutCommand() *cobra.Command {
+	cfg := &timeoutCfg{}
+
+	cmd := &cobra.Command{
+		Use:   "timeout [--signal SIG] [--kill-after DURATION] DURATION -- <command>",
+		Short: "Run a command with a time limit, signalling its whole process group",
+		Long: `Run a command with a time limit.
+
+The command is started in its own process group and every signal is sent to
+the whole group, so processes it spawned are stopped with it. Exits with 124
+if the command timed out, 137 if it was killed with SIGKILL, by --signal KILL
+or after --kill-after, and with the command's own status otherwise.`,
+		Example: `
+  timeout 30s -- ./run-tests.sh
+
+  # Ask nicely with SIGINT, then kill everything 10s later
+  timeout --signal INT --kill-after 10s 5m -- ./integration.sh
+		`,
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.Run(cmd, args)
+		},
+	}
+
+	// Everything after DURATION belongs to the command
+	cmd.Flags().SetInterspersed(false)
+
+	cmd.Flags().StringVarP(&cfg.Signal, "signal", "s", "TERM", "Signal to send to the process group on timeout")
+	cmd.Flags().DurationVarP(&cfg.KillAfter, "kill-after", "k", 0, "Also send SIGKILL if the command is still running this long after the first signal (0 to never)")
+	cmd.Flags().BoolVar(&cfg.PreserveStatus, "preserve-status", false, "Exit with the command's status even when it timed out")
+
+	return cmd
+}
+
+func (c *timeoutCfg) Run(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("expected DURATION followed by a command")
+	}
+
+	d, err := parseTimeoutDuration(args[0])
+	if err != nil {
+		return &ExitCodeError{Code: exitFailed, Err: err}
+	}
+
+	sig, err := parseSignal(c.Signal)
+	if err != nil {
+		return &ExitCodeError{Code: exitFailed, Err: err}
+	}
+
+	// Flag parsing stops at DURATION, so the -- separating the command
+	// is still there
+	args = args[1:]
+	if args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return &ExitCodeError{Code: exitFailed, Err: fmt.Errorf("expected a command after --")}
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l := clog.FromContext(ctx).With("command", strings.Join(args, " "))
+
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdin = os.Stdin
+	command.Stdout = cmd.OutOrStdout()
+	command.Stderr = cmd.ErrOrStderr()
+	command.Env = os.Environ()
+	setProcessGroup(command)
+
+	if err := command.Start(); err != nil {
+		code := exitCannotRun
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			code = exitNotFound
+		}
+		return &ExitCodeError{Code: code, Err: fmt.Errorf("failed to start command: %v", err)}
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- command.Wait()
+	}()
+
+	var deadline <-chan time.Time
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		deadline = t.C
+	}
+
+	var stage string
+	select {
+	case err := <-exited:
+		return commandResult(err)
+	case <-deadline:
+		stage = fmt.Sprintf("timed out after %s", d)
+	case <-ctx.Done():
+		stage = "interrupted"
+	}
+
+	l.InfoContextf(ctx, "command %s, sending %v to its process group", stage, sig)
+	_ = signalProcessGroup(command, sig)
+
+	var killAfter <-chan time.Time
+	if c.KillAfter > 0 {
+		t := time.NewTimer(c.KillAfter)
+		defer t.Stop()
+		killAfter = t.C
+	}
+
+	killed := false
+	var waitErr error
+	select {
+	case waitErr = <-exited:
+	case <-killAfter:
+		l.InfoContextf(ctx, "command still running %s after %v, sending SIGKILL to its process group", c.KillAfter, sig)
+		_ = signalProcessGroup(command, syscall.SIGKILL)
+		killed = true
+		waitErr = <-exited
+	}
+
+	// Reap anything the command left behind in its group
+	_ = signalProcessGroup(command, syscall.SIGKILL)
+
+	if stage == "interrupted" || c.PreserveStatus {
+		return commandResult(waitErr)
+	}
+
+	if killed {
+		return &ExitCodeError{Code: exitKilledAfter, Err: fmt.Errorf("command %s and was killed with SIGKILL after %s", stage, c.KillAfter)}
+	}
+
+	// Like coreutils, a command stopped with KILL in the first place exits
+	// as killed rather than timed out
+	if sig == syscall.SIGKILL {
+		return &ExitCodeError{Code: exitKilledAfter, Err: fmt.Errorf("command %s and was killed with SIGKILL", stage)}
+	}
+
+	return &ExitCodeError{Code: exitTimedOut, Err: fmt.Errorf("command %s and was stopped with %v", stage, sig)}
+}
+
+// commandResult maps a command's wait error onto the status we exit with,
+// using the shell convention of 128+N for a command killed by signal N.
+func commandResult(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return &ExitCodeError{Code: exitSignalBase + int(ws.Signal()), Err: err}
+	}
+
+	return &ExitCodeError{Code: exitErr.ExitCode(), Err: err}
+}
+
+// parseTimeoutDuration accepts Go durations as well as coreutils style
+// bare numbers of seconds.
+func parseTimeoutDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
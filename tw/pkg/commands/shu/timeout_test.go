@@ -0,0 +1,205 @@
+package shu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeoutDuration(t *testing.T) {
+	d, err := parseTimeoutDuration("30")
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Second, d)
+
+	d, err = parseTimeoutDuration("1.5")
+	require.NoError(t, err)
+	require.Equal(t, 1500*time.Millisecond, d)
+
+	d, err = parseTimeoutDuration("2m")
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Minute, d)
+
+	_, err = parseTimeoutDuration("-1s")
+	require.Error(t, err)
+
+	_, err = parseTimeoutDuration("soon")
+	require.Error(t, err)
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, s := range []string{"TERM", "term", "SIGTERM", "15"} {
+		sig, err := parseSignal(s)
+		require.NoError(t, err)
+		require.Equal(t, syscall.SIGTERM, sig)
+	}
+
+	_, err := parseSignal("NOPE")
+	require.Error(t, err)
+}
+
+func TestTimeoutRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      timeoutCfg
+		duration string
+		script   string
+		wantCode int
+	}{
+		{
+			name:     "command finishes in time",
+			duration: "5s",
+			script:   "exit 0",
+		},
+		{
+			name:     "command status passes through",
+			duration: "5s",
+			script:   "exit 7",
+			wantCode: 7,
+		},
+		{
+			name:     "timed out with TERM",
+			duration: "100ms",
+			script:   "sleep 30",
+			wantCode: exitTimedOut,
+		},
+		{
+			name:     "TERM ignored so KILL after",
+			cfg:      timeoutCfg{KillAfter: 100 * time.Millisecond},
+			duration: "100ms",
+			script:   "trap '' TERM; sleep 30",
+			wantCode: exitKilledAfter,
+		},
+		{
+			name:     "timed out with KILL",
+			cfg:      timeoutCfg{Signal: "KILL"},
+			duration: "100ms",
+			script:   "sleep 30",
+			wantCode: exitKilledAfter,
+		},
+		{
+			name:     "preserve status of a command that handles the signal",
+			cfg:      timeoutCfg{Signal: "INT", PreserveStatus: true},
+			duration: "100ms",
+			script:   "trap 'exit 3' INT; while true; do sleep 0.01; done",
+			wantCode: 3,
+		},
+		{
+			name:     "command not found",
+			duration: "5s",
+			wantCode: exitNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cfg.Signal == "" {
+				tt.cfg.Signal = "TERM"
+			}
+
+			args := []string{tt.duration, "bash", "-c", tt.script}
+			if tt.script == "" {
+				args = []string{tt.duration, "/does/not/exist"}
+			}
+
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+
+			start := time.Now()
+			err := tt.cfg.Run(cmd, args)
+			require.Less(t, time.Since(start), 10*time.Second)
+
+			if tt.wantCode == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var ec *ExitCodeError
+			require.True(t, errors.As(err, &ec), "expected an ExitCodeError, got %v", err)
+			require.Equal(t, tt.wantCode, ec.Code)
+		})
+	}
+}
+
+func TestTimeoutKillsGrandchildren(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "grandchild.pid")
+
+	cfg := &timeoutCfg{Signal: "TERM"}
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+
+	// The grandchild is backgrounded so only process group signalling reaches it
+	err := cfg.Run(cmd, []string{"200ms", "bash", "-c", "sleep 30 & echo $! > " + pidfile + "; wait"})
+
+	var ec *ExitCodeError
+	require.True(t, errors.As(err, &ec))
+	require.Equal(t, exitTimedOut, ec.Code)
+
+	data, err := os.ReadFile(pidfile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(string(data[:len(data)-1]))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		// An unreaped zombie is as good as gone
+		if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil && strings.Contains(string(stat), ") Z ") {
+			return true
+		}
+		proc, err := os.FindProcess(pid)
+		return err != nil || proc.Signal(syscall.Signal(0)) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTimeoutCommandSeparator(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{{
+		name: "with separator",
+		args: []string{"5s", "--", "bash", "-c", "exit 0"},
+	}, {
+		name: "without separator",
+		args: []string{"5s", "bash", "-c", "exit 0"},
+	}, {
+		name:     "flags before duration",
+		args:     []string{"--signal", "INT", "5s", "--", "bash", "-c", "exit 3"},
+		wantCode: 3,
+	}, {
+		name:     "nothing after separator",
+		args:     []string{"5s", "--"},
+		wantCode: exitFailed,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			cmd := timeoutCommand()
+			cmd.SetContext(context.Background())
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+
+			err := cmd.Execute()
+			require.NotContains(t, out.String(), "Usage:")
+
+			if tt.wantCode == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			var ec *ExitCodeError
+			require.True(t, errors.As(err, &ec), "expected an ExitCodeError, got %v", err)
+			require.Equal(t, tt.wantCode, ec.Code)
+		})
+	}
+}
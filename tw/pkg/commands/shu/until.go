@@ -0,0 +1,178 @@
+package shu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+type untilCfg struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	// InBash indicates whether the passed command should be run inside Bash.
+	InBash   bool
+	Match    string
+	JSONPath string
+	Equals   string
+
+	match    *regexp.Regexp
+	jsonPath *jsonpath.JSONPath
+}
+
+func untilCommand() *cobra.Command {
+	cfg := &untilCfg{}
+
+	cmd := &cobra.Command{
+		Use:   "until [--match REGEX] [--json-path EXPR [--equals VALUE]] -- <command>",
+		Short: "Poll a command until its output satisfies an assertion",
+		Example: `
+  # Wait for a deployment to report all replicas ready
+  until --json-path .status.readyReplicas --equals 3 -- kubectl get deploy/foo -o json
+
+  # Wait for an endpoint to return the expected version
+  until -m '"version":\s*"1\.2\.3"' -- curl -s http://localhost:8080/version
+
+  # Poll a pipeline inside Bash
+  until -b -m Running -- "kubectl get pods -l app=foo --no-headers | awk '{print \$3}'"
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.Run(cmd, args)
+		},
+	}
+
+	cmd.Flags().DurationVarP(&cfg.Interval, "interval", "i", 2*time.Second, "Time between attempts")
+	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", 5*time.Minute, "Timeout for the polling")
+	cmd.Flags().BoolVarP(&cfg.InBash, "in-bash", "b", false, "Run the passed Bash inside a Bash shell")
+	cmd.Flags().StringVarP(&cfg.Match, "match", "m", "", "Regular expression the command's stdout must match")
+	cmd.Flags().StringVar(&cfg.JSONPath, "json-path", "", "JSONPath expression evaluated against the command's stdout, e.g. .status.phase")
+	cmd.Flags().StringVar(&cfg.Equals, "equals", "", "Value the --json-path result (or the whole stdout) must equal")
+
+	return cmd
+}
+
+func (c *untilCfg) Run(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command provided")
+	}
+
+	if c.Match == "" && c.JSONPath == "" && c.Equals == "" {
+		return fmt.Errorf("at least one of --match, --json-path or --equals must be specified")
+	}
+
+	if c.Match != "" {
+		re, err := regexp.Compile(c.Match)
+		if err != nil {
+			return fmt.Errorf("failed to compile --match %q: %v", c.Match, err)
+		}
+		c.match = re
+	}
+
+	if c.JSONPath != "" {
+		expr := c.JSONPath
+		if !strings.HasPrefix(expr, "{") {
+			expr = "{" + expr + "}"
+		}
+		jp := jsonpath.New("until")
+		if err := jp.Parse(expr); err != nil {
+			return fmt.Errorf("failed to parse --json-path %q: %v", c.JSONPath, err)
+		}
+		c.jsonPath = jp
+	}
+
+	rawcmd := strings.Join(args, " ")
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	l := clog.FromContext(ctx).With("command", rawcmd)
+	l.InfoContext(ctx, "args received", "args", args, "in-bash", c.InBash)
+
+	attempt := 0
+	var lastErr error
+	for {
+		attempt++
+
+		var stdout bytes.Buffer
+		command := newCommand(ctx, c.InBash, args)
+		command.Stdout = &stdout
+		command.Stderr = cmd.ErrOrStderr()
+		command.Env = os.Environ()
+
+		if err := command.Run(); err != nil {
+			// An attempt cut short by the deadline says nothing new about
+			// the output, so report what the previous attempt saw instead.
+			if ctx.Err() != nil && lastErr != nil {
+				return fmt.Errorf("output did not match after %d attempt(s): %w", attempt-1, lastErr)
+			}
+			lastErr = fmt.Errorf("command failed: %w", err)
+		} else {
+			lastErr = c.check(stdout.Bytes())
+		}
+
+		if lastErr == nil {
+			l.InfoContextf(ctx, "[%d] output matched", attempt)
+			_, err := cmd.OutOrStdout().Write(stdout.Bytes())
+			return err
+		}
+
+		l.InfoContextf(ctx, "[%d] output did not match yet: %s", attempt, lastErr)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("output did not match after %d attempt(s): %w", attempt, lastErr)
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// check returns an error describing the first assertion out doesn't satisfy.
+func (c *untilCfg) check(out []byte) error {
+	if c.match != nil && !c.match.Match(out) {
+		return fmt.Errorf("output does not match %q", c.match.String())
+	}
+
+	if c.jsonPath == nil {
+		if c.Equals != "" && strings.TrimSpace(string(out)) != c.Equals {
+			return fmt.Errorf("output %q does not equal %q", strings.TrimSpace(string(out)), c.Equals)
+		}
+		return nil
+	}
+
+	var data any
+	if err := json.Unmarshal(out, &data); err != nil {
+		return fmt.Errorf("output is not valid JSON: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.jsonPath.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to evaluate --json-path %q: %v", c.JSONPath, err)
+	}
+	got := buf.String()
+
+	if c.Equals == "" {
+		if got == "" {
+			return fmt.Errorf("--json-path %q is empty", c.JSONPath)
+		}
+		return nil
+	}
+
+	if got != c.Equals {
+		return fmt.Errorf("--json-path %q is %q, not %q", c.JSONPath, got, c.Equals)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package shu
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUntilRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           untilCfg
+		script        string
+		expectedOut   string
+		expectedError string
+	}{
+		{
+			name:          "no assertion returns error",
+			cfg:           untilCfg{},
+			script:        "echo ready",
+			expectedError: "at least one of",
+		},
+		{
+			name:        "regex matches eventually",
+			cfg:         untilCfg{Match: "phase=Running"},
+			script:      `[ "$(cat counter)" -ge 3 ] && echo phase=Running || echo phase=Pending`,
+			expectedOut: "phase=Running\n",
+		},
+		{
+			name:        "json path equals eventually",
+			cfg:         untilCfg{JSONPath: ".status.readyReplicas", Equals: "3"},
+			script:      `echo "{\"status\": {\"readyReplicas\": $(cat counter)}}"`,
+			expectedOut: "{\"status\": {\"readyReplicas\": 3}}\n",
+		},
+		{
+			name:        "json path with braces and filter",
+			cfg:         untilCfg{JSONPath: `{.items[?(@.name=="b")].phase}`, Equals: "Ready"},
+			script:      `echo '{"items": [{"name": "a", "phase": "Pending"}, {"name": "b", "phase": "Ready"}]}'`,
+			expectedOut: "{\"items\": [{\"name\": \"a\", \"phase\": \"Pending\"}, {\"name\": \"b\", \"phase\": \"Ready\"}]}\n",
+		},
+		{
+			name:        "equals whole output",
+			cfg:         untilCfg{Equals: "done"},
+			script:      `[ "$(cat counter)" -ge 2 ] && echo done || echo working`,
+			expectedOut: "done\n",
+		},
+		{
+			name:          "never matches times out",
+			cfg:           untilCfg{Match: "never"},
+			script:        "echo nope",
+			expectedError: "output did not match",
+		},
+		{
+			name:          "invalid json never matches",
+			cfg:           untilCfg{JSONPath: ".a", Equals: "b"},
+			script:        "echo not-json",
+			expectedError: "not valid JSON",
+		},
+		{
+			name:          "failing command never matches",
+			cfg:           untilCfg{Match: "ok"},
+			script:        "echo ok; exit 1",
+			expectedError: "command failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			counter := filepath.Join(dir, "counter")
+			require.NoError(t, os.WriteFile(counter, []byte("0"), 0o644))
+
+			tt.cfg.Interval = 10 * time.Millisecond
+			tt.cfg.Timeout = 500 * time.Millisecond
+			tt.cfg.InBash = true
+
+			var out strings.Builder
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+			cmd.SetOut(&out)
+
+			// Every poll bumps the counter before running the script
+			script := "cd " + dir + "; echo $(( $(cat counter) + 1 )) > counter; " + tt.script
+			err := tt.cfg.Run(cmd, []string{script})
+
+			if tt.expectedError != "" {
+				require.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedOut, out.String())
+		})
+	}
+}
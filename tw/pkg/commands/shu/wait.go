@@ -1,11 +1,13 @@
 package shu
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/chainguard-dev/clog"
@@ -18,20 +20,55 @@ type waitCfg struct {
 	Interval    time.Duration
 	DialTimeout time.Duration
 	TCPTargets  []string
+
+	HTTPTargets      []string
+	HTTPStatus       string
+	HTTPBodyContains string
+	HTTPBodyMatch    string
+	HTTPHeaders      []string
+	HTTPCAFile       string
+	HTTPInsecure     bool
+
+	FileTargets  []string
+	FileNonEmpty bool
+	FileMatch    string
+	UnixTargets  []string
+	PIDFiles     []string
+	ExecTargets  []string
+
+	JSON bool
 }
 
 func waitCommand() *cobra.Command {
 	cfg := &waitCfg{}
 
 	cmd := &cobra.Command{
-		Use:   "wait --tcp host:port [--tcp host:port]... [-- command...]",
-		Short: "Wait for services to respond to TCP connections before running a command",
+		Use:   "wait [--tcp host:port]... [--http URL]... [--file PATH]... [--unix-socket PATH]... [--pid-file PATH]... [--exec CMD]... [-- command...]",
+		Short: "Wait for services to become ready before running a command",
 		Example: `  # Wait for a single service
   shu wait --tcp localhost:8080
 
   # Wait for multiple services
   shu wait --tcp redis:6379 --tcp postgres:5432
 
+  # Wait for an HTTP health check to return 2xx
+  shu wait --http http://localhost:8080/healthz
+
+  # Wait for a specific status and body
+  shu wait --http https://localhost:8443/ready --http-status 200 --http-body-match '"status":\s*"ok"' --http-insecure
+
+  # Wait for a daemon to write its pidfile and create its socket
+  shu wait --pid-file /run/foo.pid --unix-socket /run/foo.sock
+
+  # Wait for a log line to appear
+  shu wait --file /var/log/foo.log --file-match 'listening on'
+
+  # Wait for a command to exit 0
+  shu wait --exec 'pg_isready -h localhost'
+
+  # Give a slow database longer than the other targets and print a JSON report
+  shu wait --timeout 30s --tcp db:5432@90s --http http://localhost:8080/healthz --json
+
   # Wait and then run a command
   shu wait --tcp localhost:8080 -- echo "Service is up!"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -39,34 +76,74 @@ func waitCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", 30*time.Second, "Timeout for the wait (0 for no timeout)")
-	cmd.Flags().DurationVarP(&cfg.DialTimeout, "dial-timeout", "d", 5*time.Second, "Timeout for each dial attempt")
+	cmd.Flags().DurationVarP(&cfg.Timeout, "timeout", "t", 30*time.Second, "Timeout for each target (0 for no timeout), overridden per target, except --exec, with a TARGET@DURATION suffix")
+	cmd.Flags().DurationVarP(&cfg.DialTimeout, "dial-timeout", "d", 5*time.Second, "Timeout for each dial, request or --exec attempt")
 	cmd.Flags().DurationVarP(&cfg.Interval, "interval", "i", 1*time.Second, "Time between connection attempts")
 	cmd.Flags().StringArrayVarP(&cfg.TCPTargets, "tcp", "", nil, "TCP target host:port to wait for (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.HTTPTargets, "http", nil, "HTTP(S) URL to wait for (can be specified multiple times)")
+	cmd.Flags().StringVar(&cfg.HTTPStatus, "http-status", "200-299", "Comma separated list of expected HTTP status codes or ranges (e.g. 200,301-308)")
+	cmd.Flags().StringVar(&cfg.HTTPBodyContains, "http-body-contains", "", "Substring the HTTP response body must contain")
+	cmd.Flags().StringVar(&cfg.HTTPBodyMatch, "http-body-match", "", "Regular expression the HTTP response body must match")
+	cmd.Flags().StringArrayVar(&cfg.HTTPHeaders, "http-header", nil, "HTTP request header in 'Name: value' form (can be specified multiple times)")
+	cmd.Flags().StringVar(&cfg.HTTPCAFile, "http-ca-file", "", "PEM encoded CA bundle used to verify HTTPS targets")
+	cmd.Flags().BoolVar(&cfg.HTTPInsecure, "http-insecure", false, "Skip TLS certificate verification for HTTPS targets")
+	cmd.Flags().StringArrayVar(&cfg.FileTargets, "file", nil, "File path that must exist (can be specified multiple times)")
+	cmd.Flags().BoolVar(&cfg.FileNonEmpty, "file-non-empty", false, "Require --file targets to be non-empty")
+	cmd.Flags().StringVar(&cfg.FileMatch, "file-match", "", "Regular expression the contents of --file targets must match")
+	cmd.Flags().StringArrayVar(&cfg.UnixTargets, "unix-socket", nil, "Unix socket path to wait for a connection on (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.PIDFiles, "pid-file", nil, "Pidfile whose process must be alive (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&cfg.ExecTargets, "exec", nil, "Command run in Bash that must exit 0 (can be specified multiple times)")
+	cmd.Flags().BoolVar(&cfg.JSON, "json", false, "Print the readiness report as JSON on stdout instead of text on stderr")
 
 	return cmd
 }
 
 func (c *waitCfg) Run(cmd *cobra.Command, args []string) error {
-	if len(c.TCPTargets) == 0 {
-		return fmt.Errorf("at least one --tcp must be specified")
+	targets, err := c.targets()
+	if err != nil {
+		return err
+	}
+
+	if len(targets) == 0 {
+		return fmt.Errorf("at least one of --tcp, --http, --file, --unix-socket, --pid-file or --exec must be specified")
 	}
 
-	ctx, cancel := context.WithTimeout(cmd.Context(), c.Timeout)
-	defer cancel()
+	// The wait, and the command run after it, is bounded by the longest
+	// target timeout, which is just --timeout without per-target ones.
+	ctx := cmd.Context()
+	if timeout := longestTimeout(targets); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-	g, gctx := errgroup.WithContext(ctx)
-	for _, target := range c.TCPTargets {
+	// Targets are polled independently so one slow target doesn't cancel
+	// the others, which keeps every entry in the report meaningful.
+	results := make([]waitResult, len(targets))
+	var g errgroup.Group
+	for i, target := range targets {
 		t := target
 		g.Go(func() error {
-			return c.tcpWait(gctx, t)
+			results[i] = c.poll(ctx, t)
+			return nil
 		})
 	}
+	_ = g.Wait()
 
-	if err := g.Wait(); err != nil {
+	if err := c.report(cmd, results); err != nil {
 		return err
 	}
 
+	notReady := []string{}
+	for _, r := range results {
+		if !r.Ready {
+			notReady = append(notReady, r.Target)
+		}
+	}
+	if len(notReady) > 0 {
+		return fmt.Errorf("%d/%d target(s) not ready: %s", len(notReady), len(results), strings.Join(notReady, ", "))
+	}
+
 	if len(args) == 0 {
 		// We're done, just return
 		return nil
@@ -79,31 +156,150 @@ func (c *waitCfg) Run(cmd *cobra.Command, args []string) error {
 	return command.Run()
 }
 
-func (c *waitCfg) tcpWait(ctx context.Context, target string) error {
-	l := clog.FromContext(ctx).With("target", target)
+// waitTarget is a single readiness condition polled until its probe
+// succeeds or its timeout, if any, expires.
+type waitTarget struct {
+	kind    string
+	name    string
+	timeout time.Duration
+	probe   func(context.Context) error
+}
+
+// targets builds the probes for every condition passed on the command line.
+// A per-target timeout replaces --timeout for that target.
+func (c *waitCfg) targets() ([]waitTarget, error) {
+	targets := []waitTarget{}
+
+	add := func(kind string, specs []string, probe func(string) func(context.Context) error) {
+		for _, spec := range specs {
+			name, timeout := splitTargetTimeout(spec)
+			timeout = cmp.Or(timeout, c.Timeout)
+			targets = append(targets, waitTarget{kind: kind, name: name, timeout: timeout, probe: probe(name)})
+		}
+	}
+
+	add("tcp", c.TCPTargets, c.tcpProbe)
+
+	if len(c.HTTPTargets) > 0 {
+		p, err := newHTTPProbe(c)
+		if err != nil {
+			return nil, err
+		}
+		add("http", c.HTTPTargets, p.probe)
+	}
+
+	if len(c.FileTargets) > 0 {
+		p, err := newFileProbe(c)
+		if err != nil {
+			return nil, err
+		}
+		add("file", c.FileTargets, p.probe)
+	}
+
+	add("unix-socket", c.UnixTargets, c.unixProbe)
+	add("pid-file", c.PIDFiles, pidFileProbe)
+
+	// Scripts are taken as is, since an @ in one is as likely to be part of
+	// the command as a timeout
+	for _, script := range c.ExecTargets {
+		targets = append(targets, waitTarget{kind: "exec", name: script, timeout: c.Timeout, probe: c.execProbe(script)})
+	}
+
+	return targets, nil
+}
+
+// splitTargetTimeout splits an optional "@duration" suffix off a target
+// spec, e.g. "db:5432@60s". A suffix that isn't a valid duration is left
+// alone so URLs with userinfo keep working.
+func splitTargetTimeout(spec string) (string, time.Duration) {
+	i := strings.LastIndex(spec, "@")
+	if i < 0 {
+		return spec, 0
+	}
+
+	d, err := time.ParseDuration(spec[i+1:])
+	if err != nil || d <= 0 {
+		return spec, 0
+	}
+
+	return spec[:i], d
+}
+
+// longestTimeout returns the longest target timeout, or 0 when any target
+// waits without one.
+func longestTimeout(targets []waitTarget) time.Duration {
+	var longest time.Duration
+	for _, t := range targets {
+		if t.timeout <= 0 {
+			return 0
+		}
+		longest = max(longest, t.timeout)
+	}
+	return longest
+}
+
+func (c *waitCfg) tcpProbe(target string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		d := net.Dialer{
+			Timeout: c.DialTimeout,
+		}
+
+		conn, err := d.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// poll runs the target's probe every Interval until it succeeds, the
+// target's timeout expires or ctx is done.
+func (c *waitCfg) poll(ctx context.Context, target waitTarget) waitResult {
+	if target.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, target.timeout)
+		defer cancel()
+	}
+
+	l := clog.FromContext(ctx).With("target", target.name, "kind", target.kind)
 	start := time.Now()
 
+	res := waitResult{
+		Target: target.name,
+		Kind:   target.kind,
+	}
+
+	done := func(err error) waitResult {
+		res.Duration = time.Since(start).Round(time.Millisecond).String()
+		if err != nil {
+			res.LastError = err.Error()
+		} else {
+			res.Ready = true
+		}
+		return res
+	}
+
+	var lastErr error
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			d := net.Dialer{
-				Timeout: c.DialTimeout,
+			if lastErr == nil {
+				lastErr = ctx.Err()
 			}
-
-			conn, err := d.DialContext(ctx, "tcp", target)
-			if err == nil {
-				conn.Close()
-				l.InfoContext(ctx, "target is up", "duration", time.Since(start).Round(time.Second))
-				return nil
+			return done(lastErr)
+		default:
+			res.Attempts++
+			lastErr = target.probe(ctx)
+			if lastErr == nil {
+				l.InfoContext(ctx, "target is up", "duration", time.Since(start).Round(time.Second), "attempts", res.Attempts)
+				return done(nil)
 			}
 
-			l.InfoContext(ctx, "target is not yet up, retrying", "duration", time.Since(start).Round(time.Second))
+			l.InfoContext(ctx, "target is not yet up, retrying", "duration", time.Since(start).Round(time.Second), "err", lastErr)
 
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return done(lastErr)
 			case <-time.After(c.Interval):
 				continue
 			}
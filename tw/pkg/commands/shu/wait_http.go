@@ -0,0 +1,182 @@
+package shu
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxHTTPBody bounds how much of a response body is read for matching.
+const maxHTTPBody = 1 << 20
+
+type httpProbe struct {
+	client       *http.Client
+	headers      http.Header
+	statuses     []statusRange
+	bodyContains string
+	bodyMatch    *regexp.Regexp
+}
+
+type statusRange struct {
+	min, max int
+}
+
+func newHTTPProbe(c *waitCfg) (*httpProbe, error) {
+	statuses, err := parseStatusRanges(c.HTTPStatus)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	for _, h := range c.HTTPHeaders {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid --http-header %q, expected 'Name: value'", h)
+		}
+		headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.HTTPInsecure,
+	}
+	if c.HTTPCAFile != "" {
+		pem, err := os.ReadFile(c.HTTPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %v", c.HTTPCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.HTTPCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	p := &httpProbe{
+		client: &http.Client{
+			Timeout: c.DialTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+		headers:      headers,
+		statuses:     statuses,
+		bodyContains: c.HTTPBodyContains,
+	}
+
+	if c.HTTPBodyMatch != "" {
+		re, err := regexp.Compile(c.HTTPBodyMatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile --http-body-match %q: %v", c.HTTPBodyMatch, err)
+		}
+		p.bodyMatch = re
+	}
+
+	return p, nil
+}
+
+func (p *httpProbe) probe(url string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return p.check(ctx, url)
+	}
+}
+
+// check performs a single request against url and returns an error unless
+// the response satisfies every configured expectation.
+func (p *httpProbe) check(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	for k, vs := range p.headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	// Go treats Host specially, it is never read from req.Header
+	if host := p.headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !p.statusOK(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if p.bodyContains == "" && p.bodyMatch == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	if p.bodyContains != "" && !strings.Contains(string(body), p.bodyContains) {
+		return fmt.Errorf("response body does not contain %q", p.bodyContains)
+	}
+
+	if p.bodyMatch != nil && !p.bodyMatch.Match(body) {
+		return fmt.Errorf("response body does not match %q", p.bodyMatch.String())
+	}
+
+	return nil
+}
+
+func (p *httpProbe) statusOK(code int) bool {
+	for _, r := range p.statuses {
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusRanges parses a comma separated list of status codes and
+// inclusive ranges, such as "200,301-308".
+func parseStatusRanges(s string) ([]statusRange, error) {
+	ranges := []statusRange{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		lo, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q in %q", from, s)
+		}
+		hi, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q in %q", to, s)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+
+		ranges = append(ranges, statusRange{min: lo, max: hi})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status codes provided")
+	}
+
+	return ranges, nil
+}
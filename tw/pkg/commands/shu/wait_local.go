@@ -0,0 +1,131 @@
+package shu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type fileProbe struct {
+	nonEmpty bool
+	match    *regexp.Regexp
+}
+
+func newFileProbe(c *waitCfg) (*fileProbe, error) {
+	p := &fileProbe{
+		nonEmpty: c.FileNonEmpty,
+	}
+
+	if c.FileMatch != "" {
+		re, err := regexp.Compile(c.FileMatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile --file-match %q: %v", c.FileMatch, err)
+		}
+		p.match = re
+	}
+
+	return p, nil
+}
+
+func (p *fileProbe) probe(path string) func(context.Context) error {
+	return func(_ context.Context) error {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if p.nonEmpty && fi.Size() == 0 {
+			return fmt.Errorf("file %s is empty", path)
+		}
+
+		if p.match == nil {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if !p.match.Match(data) {
+			return fmt.Errorf("file %s does not match %q", path, p.match.String())
+		}
+
+		return nil
+	}
+}
+
+func (c *waitCfg) unixProbe(path string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		d := net.Dialer{
+			Timeout: c.DialTimeout,
+		}
+
+		conn, err := d.DialContext(ctx, "unix", path)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// pidFileProbe succeeds once path holds the pid of a running process.
+func pidFileProbe(path string) func(context.Context) error {
+	return func(_ context.Context) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || pid <= 0 {
+			return fmt.Errorf("pidfile %s does not contain a valid pid", path)
+		}
+
+		proc, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+
+		// Signal 0 performs the existence and permission checks without
+		// delivering anything. EPERM still means the process is alive.
+		if err := proc.Signal(syscall.Signal(0)); err != nil && !errors.Is(err, syscall.EPERM) {
+			return fmt.Errorf("process %d from %s is not running: %v", pid, path, err)
+		}
+
+		return nil
+	}
+}
+
+func (c *waitCfg) execProbe(script string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, c.DialTimeout)
+		defer cancel()
+
+		command := newCommand(ctx, true, []string{script})
+		command.Env = os.Environ()
+
+		out, err := command.CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("%v: %s", err, lastLine(msg))
+			}
+			return err
+		}
+
+		return nil
+	}
+}
+
+func lastLine(s string) string {
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package shu
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// waitResult records how a single target fared.
+type waitResult struct {
+	Target    string `json:"target"`
+	Kind      string `json:"kind"`
+	Ready     bool   `json:"ready"`
+	Attempts  int    `json:"attempts"`
+	Duration  string `json:"duration"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// report prints the readiness summary, as JSON on stdout when --json is
+// set and as a table on stderr otherwise.
+func (c *waitCfg) report(cmd *cobra.Command, results []waitResult) error {
+	if c.JSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return fmt.Errorf("failed to encode json: %v", err)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.ErrOrStderr(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tKIND\tSTATUS\tATTEMPTS\tDURATION\tLAST ERROR")
+	for _, r := range results {
+		status := "ready"
+		if !r.Ready {
+			status = "not ready"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", r.Target, r.Kind, status, r.Attempts, r.Duration, r.LastError)
+	}
+	return w.Flush()
+}
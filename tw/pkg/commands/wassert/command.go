@@ -0,0 +1,196 @@
+package wassert
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+)
+
+type commandCfg struct {
+	File string `json:"file"`
+
+	Commands []commandEntry `json:"commands"`
+
+	// Eventually retries every failing entry that doesn't set its own.
+	Eventually *eventually `json:"eventually"`
+
+	root *cfg
+}
+
+type commandEntry struct {
+	entryOptions
+
+	// Cmd is run with Shell, which defaults to "/bin/sh -c".
+	Cmd   string `json:"cmd"`
+	Shell string `json:"shell"`
+
+	ExitCode int               `json:"exit_code"`
+	Stdin    string            `json:"stdin"`
+	Env      map[string]string `json:"env"`
+	Dir      string            `json:"dir"`
+	Timeout  duration          `json:"timeout"`
+
+	Stdout outputEntry `json:"stdout"`
+	Stderr outputEntry `json:"stderr"`
+
+	// dir is the --dir Dir is relative to, and the command runs in without
+	// one.
+	dir string
+}
+
+// outputEntry asserts on a captured stream. Contains passes if the output
+// contains any of its lines and NotContains requires none of them to be
+// found. Matches is a regex applied to the whole output.
+type outputEntry struct {
+	Contains    string `json:"contains"`
+	NotContains string `json:"not_contains"`
+	Matches     string `json:"matches"`
+}
+
+func commandCommand(root *cfg) *cobra.Command {
+	cfg := &commandCfg{root: root}
+
+	cmd := &cobra.Command{
+		Use:   "command",
+		Short: "Assert things about the result of running a command",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return reload(resolve(root.Dir, cfg.File), cfg)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.Run(cmd, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&cfg.File, "file", "f", "", "File to read config from")
+
+	return cmd
+}
+
+func (c *commandCfg) reset() {
+	c.Commands = nil
+	c.Eventually = nil
+}
+
+func (c *commandCfg) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	clog.InfoContext(ctx, "wassert command", "file", c.File)
+
+	entries := make([]assertion, 0, len(c.Commands))
+	for i := range c.Commands {
+		c.Commands[i].dir = c.root.Dir
+		entries = append(entries, &c.Commands[i])
+	}
+
+	return c.root.runAssertions(ctx, "command", c.Eventually, entries)
+}
+
+func (e *commandEntry) Name() string {
+	return e.Cmd
+}
+
+func (e *commandEntry) Assert(ctx context.Context) error {
+	if e.Cmd == "" {
+		return &assertError{msg: "command entry has no cmd"}
+	}
+
+	clog.InfoContext(ctx, "running", "cmd", e.Cmd)
+
+	if e.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout.Duration)
+		defer cancel()
+	}
+
+	shell := strings.Fields(e.Shell)
+	if len(shell) == 0 {
+		shell = []string{"/bin/sh", "-c"}
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, shell[0], append(shell[1:], e.Cmd)...)
+	c.Stdin = strings.NewReader(e.Stdin)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	c.Dir = resolve(e.dir, cmp.Or(e.Dir, "."))
+	// Don't wait on children that outlive a timed out shell and hold its
+	// output open
+	c.WaitDelay = time.Second
+	c.Env = os.Environ()
+	for k, v := range e.Env {
+		c.Env = append(c.Env, k+"="+v)
+	}
+
+	err := c.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return &assertError{msg: fmt.Sprintf("command %q timed out after %s", e.Cmd, e.Timeout.Duration)}
+	}
+
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return &assertError{msg: fmt.Sprintf("failed to run command %q: %v", e.Cmd, err)}
+		}
+		code = exitErr.ExitCode()
+	}
+
+	if code != e.ExitCode {
+		msg := fmt.Sprintf("command %q exited with %d, not %d", e.Cmd, code, e.ExitCode)
+		if line := lastLine(stderr.String()); line != "" {
+			msg += ": " + line
+		}
+		return &assertError{msg: msg}
+	}
+
+	if err := e.Stdout.assert(e.Cmd, "stdout", stdout.String()); err != nil {
+		return err
+	}
+
+	return e.Stderr.assert(e.Cmd, "stderr", stderr.String())
+}
+
+func (o *outputEntry) assert(cmd, stream, out string) error {
+	if o.Contains != "" {
+		expects := strings.Split(strings.TrimSpace(o.Contains), "\n")
+		if !lineMatches(out, expects...) {
+			return &assertError{msg: fmt.Sprintf("%s of %q does not contain any of %s", stream, cmd, o.Contains)}
+		}
+	}
+
+	if o.NotContains != "" {
+		for _, unexpected := range strings.Split(strings.TrimSpace(o.NotContains), "\n") {
+			if strings.Contains(out, unexpected) {
+				return &assertError{msg: fmt.Sprintf("%s of %q contains %q", stream, cmd, unexpected)}
+			}
+		}
+	}
+
+	if o.Matches != "" {
+		re, err := regexp.Compile(o.Matches)
+		if err != nil {
+			return &assertError{msg: fmt.Sprintf("invalid regex %q: %v", o.Matches, err)}
+		}
+		if !re.MatchString(out) {
+			return &assertError{msg: fmt.Sprintf("%s of %q does not match %q", stream, cmd, o.Matches)}
+		}
+	}
+
+	return nil
+}
+
+// lastLine returns the last non-empty line of s, which is usually the most
+// useful bit of a failing command's stderr.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
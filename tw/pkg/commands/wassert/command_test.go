@@ -0,0 +1,55 @@
+package wassert
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputEntryAssert(t *testing.T) {
+	const out = "starting\nlistening on :8080\ndone\n"
+
+	tests := []struct {
+		name    string
+		entry   outputEntry
+		wantErr string
+	}{{
+		name: "empty passes",
+	}, {
+		name:  "contains any line",
+		entry: outputEntry{Contains: "not there\nlistening on"},
+	}, {
+		name:    "contains none",
+		entry:   outputEntry{Contains: "goodbye\nfarewell"},
+		wantErr: "stdout of \"serve\" does not contain any of goodbye\nfarewell",
+	}, {
+		name:  "not contains",
+		entry: outputEntry{NotContains: "panic\nerror"},
+	}, {
+		name:    "not contains any line",
+		entry:   outputEntry{NotContains: "panic\ndone"},
+		wantErr: `stdout of "serve" contains "done"`,
+	}, {
+		name:  "matches the whole output",
+		entry: outputEntry{Matches: `(?s)starting.*done`},
+	}, {
+		name:    "does not match",
+		entry:   outputEntry{Matches: `^listening`},
+		wantErr: `stdout of "serve" does not match "^listening"`,
+	}, {
+		name:    "invalid regex",
+		entry:   outputEntry{Matches: `(`},
+		wantErr: `invalid regex "("`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.assert("serve", "stdout", out)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package wassert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+type docCfg struct {
+	File string `json:"file"`
+
+	Docs []docEntry `json:"docs"`
+
+	// Eventually retries every failing entry that doesn't set its own.
+	Eventually *eventually `json:"eventually"`
+
+	root *cfg
+}
+
+type docEntry struct {
+	entryOptions
+
+	// File is the document to load. Format is one of json, yaml or toml and
+	// defaults to the file's extension.
+	File   string `json:"file"`
+	Format string `json:"format"`
+
+	// Path is a JSONPath expression such as ".server.port" or
+	// ".listeners[*].port". Every value it selects must satisfy the
+	// assertions below.
+	Path      string `json:"path"`
+	NotExists bool   `json:"not_exists"`
+
+	// Equals is compared against the value after both are decoded, so
+	// 8080 and "8080" are different. Type is one of string, number, bool,
+	// object, array or null. Matches is a regex applied to strings as-is
+	// and to anything else encoded as JSON.
+	Equals  json.RawMessage `json:"equals"`
+	Type    string          `json:"type"`
+	Matches string          `json:"matches"`
+
+	// dir is the --dir File is relative to.
+	dir string
+}
+
+func docCommand(root *cfg) *cobra.Command {
+	cfg := &docCfg{root: root}
+
+	cmd := &cobra.Command{
+		Use:   "doc",
+		Short: "Assert values in a JSON, YAML or TOML document",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return reload(resolve(root.Dir, cfg.File), cfg)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.Run(cmd, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&cfg.File, "file", "f", "", "File to read config from")
+
+	return cmd
+}
+
+func (c *docCfg) reset() {
+	c.Docs = nil
+	c.Eventually = nil
+}
+
+func (c *docCfg) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	clog.InfoContext(ctx, "wassert doc", "file", c.File)
+
+	entries := make([]assertion, 0, len(c.Docs))
+	for i := range c.Docs {
+		c.Docs[i].dir = c.root.Dir
+		entries = append(entries, &c.Docs[i])
+	}
+
+	return c.root.runAssertions(ctx, "doc", c.Eventually, entries)
+}
+
+func (e *docEntry) Name() string {
+	return e.File + " " + e.Path
+}
+
+func (e *docEntry) Assert(ctx context.Context) error {
+	clog.InfoContext(ctx, "doc", "file", e.File, "path", e.Path)
+
+	data, err := e.load()
+	if err != nil {
+		return err
+	}
+
+	expr := e.Path
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	jp := jsonpath.New("doc").AllowMissingKeys(e.NotExists)
+	if err := jp.Parse(expr); err != nil {
+		return &assertError{msg: fmt.Sprintf("invalid path %q: %v", e.Path, err)}
+	}
+
+	results, err := jp.FindResults(data)
+	if err != nil {
+		return &assertError{msg: fmt.Sprintf("doc %s %s: %v", e.File, e.Path, err)}
+	}
+
+	values := []any{}
+	for _, r := range results {
+		for _, v := range r {
+			values = append(values, v.Interface())
+		}
+	}
+
+	if e.NotExists {
+		if len(values) > 0 {
+			return &assertError{msg: fmt.Sprintf("doc %s %s exists", e.File, e.Path)}
+		}
+		return nil
+	}
+
+	if len(values) == 0 {
+		return &assertError{msg: fmt.Sprintf("doc %s %s is not found", e.File, e.Path)}
+	}
+
+	for _, v := range values {
+		if err := e.assertValue(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load decodes the document into the same shape encoding/json would, so
+// values compare the same whatever format they came from.
+func (e *docEntry) load() (any, error) {
+	raw, err := os.ReadFile(resolve(e.dir, e.File))
+	if err != nil {
+		return nil, &assertError{msg: fmt.Sprintf("failed to read doc %s", e.File)}
+	}
+
+	format := e.Format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(e.File), ".")
+	}
+
+	var data any
+	switch format {
+	case "json", "yaml", "yml":
+		// YAML is a superset of JSON, so one decoder handles both
+		err = yaml.Unmarshal(raw, &data)
+	case "toml":
+		var m map[string]any
+		if err = toml.Unmarshal(raw, &m); err == nil {
+			data, err = normalize(m)
+		}
+	default:
+		return nil, &assertError{msg: fmt.Sprintf("unknown format %q for doc %s, expected one of json, yaml or toml", format, e.File)}
+	}
+	if err != nil {
+		return nil, &assertError{msg: fmt.Sprintf("failed to parse doc %s as %s: %v", e.File, format, err)}
+	}
+
+	return data, nil
+}
+
+func (e *docEntry) assertValue(v any) error {
+	if e.Type != "" {
+		got := jsonType(v)
+		if got != e.Type {
+			return &assertError{msg: fmt.Sprintf("doc %s %s is of type %s, not %s", e.File, e.Path, got, e.Type)}
+		}
+	}
+
+	if len(e.Equals) > 0 {
+		var want any
+		if err := json.Unmarshal(e.Equals, &want); err != nil {
+			return &assertError{msg: fmt.Sprintf("invalid equals for %s: %v", e.Path, err)}
+		}
+		if !reflect.DeepEqual(v, want) {
+			return &assertError{msg: fmt.Sprintf("doc %s %s is %s, not %s", e.File, e.Path, encode(v), encode(want))}
+		}
+	}
+
+	if e.Matches != "" {
+		re, err := regexp.Compile(e.Matches)
+		if err != nil {
+			return &assertError{msg: fmt.Sprintf("invalid regex %q: %v", e.Matches, err)}
+		}
+		if !re.MatchString(text(v)) {
+			return &assertError{msg: fmt.Sprintf("doc %s %s is %s, which does not match %q", e.File, e.Path, text(v), e.Matches)}
+		}
+	}
+
+	return nil
+}
+
+// normalize round-trips v through JSON, turning TOML's integers and
+// datetimes into the float64s and strings every other format decodes to.
+func normalize(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out any
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// text renders strings as-is and anything else as compact JSON.
+func text(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return encode(v)
+}
+
+func encode(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(buf.String())
+}
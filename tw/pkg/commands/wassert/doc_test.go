@@ -0,0 +1,93 @@
+package wassert
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocEntryAssert(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	docs := map[string]string{
+		"app.json": `{"server": {"port": 8080, "tags": ["a", "b"]}, "listeners": [{"port": 80}, {"port": 443}]}`,
+		"app.yaml": "server:\n  port: 8080\n  host: localhost\n",
+		"app.toml": "[server]\nport = 8080\nstarted = 2024-01-02T03:04:05Z\n",
+		"app.conf": `{"server": {"port": 8080}}`,
+	}
+	for name, data := range docs {
+		require.NoError(t, os.WriteFile(name, []byte(data), 0o644))
+	}
+
+	tests := []struct {
+		name    string
+		entry   docEntry
+		wantErr string
+	}{{
+		name:  "json equals",
+		entry: docEntry{File: "app.json", Path: ".server.port", Equals: json.RawMessage(`8080`)},
+	}, {
+		name:    "json equals is type sensitive",
+		entry:   docEntry{File: "app.json", Path: ".server.port", Equals: json.RawMessage(`"8080"`)},
+		wantErr: `doc app.json .server.port is 8080, not "8080"`,
+	}, {
+		name:  "every selected value is checked",
+		entry: docEntry{File: "app.json", Path: ".listeners[*].port", Type: "number"},
+	}, {
+		name:    "one selected value failing fails the entry",
+		entry:   docEntry{File: "app.json", Path: ".listeners[*].port", Matches: "^80$"},
+		wantErr: `is 443, which does not match "^80$"`,
+	}, {
+		name:    "type",
+		entry:   docEntry{File: "app.json", Path: ".server.tags", Type: "object"},
+		wantErr: "doc app.json .server.tags is of type array, not object",
+	}, {
+		name:  "matches non strings as json",
+		entry: docEntry{File: "app.json", Path: ".server.tags", Matches: `^\["a","b"\]$`},
+	}, {
+		name:  "yaml",
+		entry: docEntry{File: "app.yaml", Path: ".server.host", Equals: json.RawMessage(`"localhost"`)},
+	}, {
+		name:  "toml numbers decode like json",
+		entry: docEntry{File: "app.toml", Path: ".server.port", Equals: json.RawMessage(`8080`)},
+	}, {
+		name:  "toml datetimes decode to strings",
+		entry: docEntry{File: "app.toml", Path: ".server.started", Type: "string"},
+	}, {
+		name:  "format overrides the extension",
+		entry: docEntry{File: "app.conf", Format: "json", Path: ".server.port", Equals: json.RawMessage(`8080`)},
+	}, {
+		name:    "unknown format",
+		entry:   docEntry{File: "app.conf", Path: ".server.port"},
+		wantErr: `unknown format "conf"`,
+	}, {
+		name:  "not exists",
+		entry: docEntry{File: "app.yaml", Path: ".server.tls", NotExists: true},
+	}, {
+		name:    "not exists but does",
+		entry:   docEntry{File: "app.yaml", Path: ".server.port", NotExists: true},
+		wantErr: "doc app.yaml .server.port exists",
+	}, {
+		name:    "missing path",
+		entry:   docEntry{File: "app.yaml", Path: ".server.tls"},
+		wantErr: "doc app.yaml .server.tls",
+	}, {
+		name:    "missing file",
+		entry:   docEntry{File: "missing.json", Path: ".server"},
+		wantErr: "failed to read doc",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.Assert(context.Background())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
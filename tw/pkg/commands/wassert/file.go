@@ -3,44 +3,74 @@ package wassert
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/user"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/chainguard-dev/clog"
 	"github.com/spf13/cobra"
-	"sigs.k8s.io/yaml"
 )
 
 type fileCfg struct {
 	File string `json:"file"`
 
 	Files []fileEntry `json:"files"`
+
+	// Eventually retries every failing entry that doesn't set its own.
+	Eventually *eventually `json:"eventually"`
+
+	root *cfg
 }
 
 type fileEntry struct {
-	Path     string `json:"path"`
-	Exists   bool   `json:"exists"`
-	Contains string `json:"contains"`
+	entryOptions
+
+	Path      string `json:"path"`
+	Exists    bool   `json:"exists"`
+	NotExists bool   `json:"not_exists"`
+
+	// Type is one of file, dir or symlink, and is checked without following
+	// symlinks.
+	Type          string `json:"type"`
+	SymlinkTarget string `json:"symlink_target"`
+
+	// Mode is an octal string such as "0755", including any setuid, setgid
+	// or sticky bits. Owner and Group accept names or numeric ids.
+	Mode  string `json:"mode"`
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+
+	MinSize *int64 `json:"min_size"`
+	MaxSize *int64 `json:"max_size"`
+	SHA256  string `json:"sha256"`
+
+	// Contains passes if any line contains any of its lines, ContainsAll
+	// requires every one of its lines to be found and NotContains requires
+	// none of them to be. Matches is a regex applied to the whole file.
+	Contains    string `json:"contains"`
+	ContainsAll string `json:"contains_all"`
+	NotContains string `json:"not_contains"`
+	Matches     string `json:"matches"`
+
+	// dir is the --dir Path is relative to.
+	dir string
 }
 
-func fileCommand() *cobra.Command {
-	cfg := &fileCfg{}
+func fileCommand(root *cfg) *cobra.Command {
+	cfg := &fileCfg{root: root}
 
 	cmd := &cobra.Command{
 		Use:   "file",
 		Short: "Assert things about a file on disk",
 		PreRunE: func(cmd *cobra.Command, args []string) error {
-			if cfg.File == "" {
-				return nil
-			}
-
-			data, err := os.ReadFile(cfg.File)
-			if err != nil {
-				return err
-			}
-
-			return yaml.Unmarshal(data, cfg)
+			return reload(resolve(root.Dir, cfg.File), cfg)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cfg.Run(cmd, args)
@@ -52,89 +82,435 @@ func fileCommand() *cobra.Command {
 	return cmd
 }
 
+func (c *fileCfg) reset() {
+	c.Files = nil
+	c.Eventually = nil
+}
+
 func (c *fileCfg) Run(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
 	clog.InfoContext(ctx, "wassert file", "file", c.File)
 
-	passes := true
-	for _, f := range c.Files {
-		err := f.Assert(ctx)
-		if err != nil {
-			clog.ErrorContext(ctx, "assertion failed", "err", err)
-			passes = false
-		}
+	entries := make([]assertion, 0, len(c.Files))
+	for i := range c.Files {
+		c.Files[i].dir = c.root.Dir
+		entries = append(entries, &c.Files[i])
 	}
 
-	if !passes {
-		return fmt.Errorf("file assertion failed")
-	}
+	return c.root.runAssertions(ctx, "file", c.Eventually, entries)
+}
 
-	clog.InfoContext(ctx, "all assertions passed")
+// path is where the entry's file is, with its Path resolved against the
+// --dir wassert runs in.
+func (e *fileEntry) path() string {
+	return resolve(e.dir, e.Path)
+}
 
-	return nil
+func (e *fileEntry) Name() string {
+	return e.Path
 }
 
 func (e *fileEntry) Assert(ctx context.Context) error {
+	if e.NotExists {
+		clog.InfoContext(ctx, "not_exists", "path", e.Path)
+
+		if _, err := os.Lstat(e.path()); err == nil {
+			return &fileAssertError{msg: fmt.Sprintf("file %s exists", e.Path)}
+		}
+
+		// Nothing else can be asserted about a file that must not exist
+		return nil
+	}
+
 	if e.Exists {
 		clog.InfoContext(ctx, "exists", "path", e.Path)
 
-		_, err := os.Stat(e.Path)
+		_, err := os.Stat(e.path())
 		if err != nil {
 			return &fileAssertError{msg: fmt.Sprintf("file %s does not exist", e.Path)}
 		}
 	}
 
-	if e.Contains != "" {
-		clog.InfoContext(ctx, "contains", "path", e.Path, "contains", e.Contains)
+	for _, check := range []func(context.Context) error{
+		e.assertType,
+		e.assertSymlinkTarget,
+		e.assertMode,
+		e.assertOwnership,
+		e.assertSize,
+		e.assertSHA256,
+		e.assertContains,
+		e.assertContainsAll,
+		e.assertNotContains,
+		e.assertMatches,
+	} {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
 
-		fn := func() error {
-			f, err := os.Open(e.Path)
-			if err != nil {
-				return &fileAssertError{msg: fmt.Sprintf("failed to open file %s", e.Path)}
-			}
-			defer f.Close()
+	return nil
+}
 
-			expects := strings.Split(strings.TrimSpace(e.Contains), "\n")
+func (e *fileEntry) assertType(ctx context.Context) error {
+	if e.Type == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "type", "path", e.Path, "type", e.Type)
 
-			// at least one line must match at least one expect
-			matched := false
+	fi, err := os.Lstat(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to stat file %s", e.Path)}
+	}
 
-			scanner := bufio.NewScanner(f)
-			i := 0
-			for scanner.Scan() {
-				line := scanner.Text()
-				i++
+	got := fileType(fi)
 
-				if lineMatches(line, expects...) {
-					clog.InfoContext(ctx, "found line match", "line", line, "expect", expects, "line_number", i)
-					matched = true
-					break
-				}
+	switch e.Type {
+	case "file", "dir", "symlink":
+	default:
+		return &fileAssertError{msg: fmt.Sprintf("invalid type %q for %s, expected one of file, dir or symlink", e.Type, e.Path)}
+	}
 
-				if matched {
-					break
-				}
-			}
+	if got != e.Type {
+		return &fileAssertError{msg: fmt.Sprintf("file %s is a %s, not a %s", e.Path, got, e.Type)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertSymlinkTarget(ctx context.Context) error {
+	if e.SymlinkTarget == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "symlink_target", "path", e.Path, "symlink_target", e.SymlinkTarget)
+
+	target, err := os.Readlink(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("file %s is not a symlink", e.Path)}
+	}
 
-			if !matched {
-				return &fileAssertError{msg: fmt.Sprintf("file %s does not contain any of %s", e.Path, e.Contains)}
+	if target != e.SymlinkTarget {
+		return &fileAssertError{msg: fmt.Sprintf("symlink %s points to %s, not %s", e.Path, target, e.SymlinkTarget)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertMode(ctx context.Context) error {
+	if e.Mode == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "mode", "path", e.Path, "mode", e.Mode)
+
+	want, err := strconv.ParseUint(e.Mode, 8, 32)
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("invalid mode %q for %s, expected an octal string like \"0755\"", e.Mode, e.Path)}
+	}
+
+	fi, err := os.Stat(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to stat file %s", e.Path)}
+	}
+
+	got := modeBits(fi)
+	if got != want {
+		return &fileAssertError{msg: fmt.Sprintf("file %s has mode %04o, not %04o", e.Path, got, want)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertOwnership(ctx context.Context) error {
+	if e.Owner == "" && e.Group == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "ownership", "path", e.Path, "owner", e.Owner, "group", e.Group)
+
+	fi, err := os.Stat(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to stat file %s", e.Path)}
+	}
+
+	uid, gid, ok := fileOwnership(fi)
+	if !ok {
+		return &fileAssertError{msg: fmt.Sprintf("ownership of %s is not available on this platform", e.Path)}
+	}
+
+	if e.Owner != "" {
+		want, err := lookupUID(e.Owner)
+		if err != nil {
+			return &fileAssertError{msg: fmt.Sprintf("unknown owner %q for %s: %v", e.Owner, e.Path, err)}
+		}
+		if uid != want {
+			return &fileAssertError{msg: fmt.Sprintf("file %s is owned by uid %d, not %s", e.Path, uid, e.Owner)}
+		}
+	}
+
+	if e.Group != "" {
+		want, err := lookupGID(e.Group)
+		if err != nil {
+			return &fileAssertError{msg: fmt.Sprintf("unknown group %q for %s: %v", e.Group, e.Path, err)}
+		}
+		if gid != want {
+			return &fileAssertError{msg: fmt.Sprintf("file %s is owned by gid %d, not %s", e.Path, gid, e.Group)}
+		}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertSize(ctx context.Context) error {
+	if e.MinSize == nil && e.MaxSize == nil {
+		return nil
+	}
+	clog.InfoContext(ctx, "size", "path", e.Path)
+
+	fi, err := os.Stat(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to stat file %s", e.Path)}
+	}
+
+	if e.MinSize != nil && fi.Size() < *e.MinSize {
+		return &fileAssertError{msg: fmt.Sprintf("file %s is %d bytes, smaller than min_size %d", e.Path, fi.Size(), *e.MinSize)}
+	}
+
+	if e.MaxSize != nil && fi.Size() > *e.MaxSize {
+		return &fileAssertError{msg: fmt.Sprintf("file %s is %d bytes, larger than max_size %d", e.Path, fi.Size(), *e.MaxSize)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertSHA256(ctx context.Context) error {
+	if e.SHA256 == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "sha256", "path", e.Path, "sha256", e.SHA256)
+
+	got, err := fileSHA256(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to read file %s", e.Path)}
+	}
+
+	if !strings.EqualFold(got, strings.TrimPrefix(e.SHA256, "sha256:")) {
+		return &fileAssertError{msg: fmt.Sprintf("file %s has sha256 %s, not %s", e.Path, got, e.SHA256)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertContains(ctx context.Context) error {
+	if e.Contains == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "contains", "path", e.Path, "contains", e.Contains)
+
+	expects := strings.Split(strings.TrimSpace(e.Contains), "\n")
+
+	// at least one line must match at least one expect
+	matched := false
+	err := e.scanLines(func(line string, i int) bool {
+		if lineMatches(line, expects...) {
+			clog.InfoContext(ctx, "found line match", "line", line, "expect", expects, "line_number", i)
+			matched = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if !matched {
+		return &fileAssertError{msg: fmt.Sprintf("file %s does not contain any of %s", e.Path, e.Contains)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertContainsAll(ctx context.Context) error {
+	if e.ContainsAll == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "contains_all", "path", e.Path, "contains_all", e.ContainsAll)
+
+	expects := strings.Split(strings.TrimSpace(e.ContainsAll), "\n")
+
+	// every expect must match at least one line
+	found := make(map[string]bool, len(expects))
+	err := e.scanLines(func(line string, _ int) bool {
+		for _, expect := range expects {
+			if strings.Contains(line, expect) {
+				found[expect] = true
 			}
+		}
+		return len(found) < len(expects)
+	})
+	if err != nil {
+		return err
+	}
 
-			return nil
+	missing := []string{}
+	for _, expect := range expects {
+		if !found[expect] {
+			missing = append(missing, expect)
 		}
+	}
 
-		if err := fn(); err != nil {
-			return err
+	if len(missing) > 0 {
+		return &fileAssertError{msg: fmt.Sprintf("file %s does not contain %s", e.Path, strings.Join(missing, ", "))}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertNotContains(ctx context.Context) error {
+	if e.NotContains == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "not_contains", "path", e.Path, "not_contains", e.NotContains)
+
+	expects := strings.Split(strings.TrimSpace(e.NotContains), "\n")
+
+	var found string
+	lineno := 0
+	err := e.scanLines(func(line string, i int) bool {
+		if lineMatches(line, expects...) {
+			found, lineno = line, i
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if found != "" {
+		return &fileAssertError{msg: fmt.Sprintf("file %s line %d contains unexpected content: %s", e.Path, lineno, found)}
+	}
+
+	return nil
+}
+
+func (e *fileEntry) assertMatches(ctx context.Context) error {
+	if e.Matches == "" {
+		return nil
+	}
+	clog.InfoContext(ctx, "matches", "path", e.Path, "matches", e.Matches)
+
+	re, err := regexp.Compile(e.Matches)
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("invalid regex %q for %s: %v", e.Matches, e.Path, err)}
+	}
+
+	data, err := os.ReadFile(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to open file %s", e.Path)}
+	}
+
+	if !re.Match(data) {
+		return &fileAssertError{msg: fmt.Sprintf("file %s does not match %s", e.Path, e.Matches)}
+	}
+
+	return nil
+}
+
+// maxLineSize is the longest line scanLines reads before failing.
+const maxLineSize = 16 * 1024 * 1024
+
+// scanLines calls fn with each line of the file and its 1-based number
+// until fn returns false.
+func (e *fileEntry) scanLines(fn func(line string, lineno int) bool) error {
+	f, err := os.Open(e.path())
+	if err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to open file %s", e.Path)}
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+	i := 0
+	for scanner.Scan() {
+		i++
+		if !fn(scanner.Text(), i) {
+			return nil
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		return &fileAssertError{msg: fmt.Sprintf("failed to read line %d of file %s: %v", i+1, e.Path, err)}
+	}
+
 	return nil
 }
 
-type fileAssertError struct {
-	msg string
+// fileType names the type of fi the way the type assertion expects it.
+func fileType(fi fs.FileInfo) string {
+	switch {
+	case fi.Mode().IsRegular():
+		return "file"
+	case fi.IsDir():
+		return "dir"
+	case fi.Mode()&fs.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return fi.Mode().Type().String()
+	}
 }
 
-func (e *fileAssertError) Error() string {
-	return e.msg
+// modeBits returns fi's permissions along with its setuid, setgid and
+// sticky bits, as they'd be written in octal.
+func modeBits(fi fs.FileInfo) uint64 {
+	bits := uint64(fi.Mode().Perm())
+	if fi.Mode()&fs.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if fi.Mode()&fs.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if fi.Mode()&fs.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
 }
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookupUID resolves a user name or numeric uid.
+func lookupUID(owner string) (int, error) {
+	if id, err := strconv.Atoi(owner); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID resolves a group name or numeric gid.
+func lookupGID(group string) (int, error) {
+	if id, err := strconv.Atoi(group); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// fileAssertError is the assertError of file entries.
+type fileAssertError = assertError
@@ -0,0 +1,62 @@
+package wassert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileEntryLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "long.log")
+	data := strings.Repeat("x", 100*1024) + "\nERROR after a long line\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	e := &fileEntry{Path: path, NotContains: "ERROR"}
+	require.ErrorContains(t, e.Assert(context.Background()), "line 2 contains unexpected content")
+
+	e = &fileEntry{Path: path, Contains: "after a long line"}
+	require.NoError(t, e.Assert(context.Background()))
+}
+
+func TestFileEntryOwnership(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file ownership is not available on windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "owned")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+	other := strconv.Itoa(os.Getuid() + 1)
+
+	tests := []struct {
+		name    string
+		owner   string
+		group   string
+		wantErr string
+	}{
+		{name: "uid", owner: uid},
+		{name: "gid", group: gid},
+		{name: "uid and gid", owner: uid, group: gid},
+		{name: "uid mismatch", owner: other, group: gid, wantErr: fmt.Sprintf("file %s is owned by uid %s, not %s", path, uid, other)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &fileEntry{Path: path, Owner: tt.owner, Group: tt.group}
+			err := e.Assert(context.Background())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+// +build unix
+
+package wassert
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwnership returns the uid and gid that own fi.
+func fileOwnership(fi fs.FileInfo) (int, int, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,136 @@
+package wassert
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+)
+
+// result is the outcome of asserting a single entry.
+type result struct {
+	Name     string
+	Err      error
+	Attempts int
+	Duration time.Duration
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type jsonReport struct {
+	Kind     string       `json:"kind"`
+	Tests    int          `json:"tests"`
+	Failures int          `json:"failures"`
+	Results  []jsonResult `json:"results"`
+}
+
+type jsonResult struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Failure  string `json:"failure,omitempty"`
+	Attempts int    `json:"attempts"`
+	Duration string `json:"duration"`
+}
+
+// writeReport writes results to the --report file, replacing anything a
+// previous run left there.
+func (c *cfg) writeReport(kind string, results []result) error {
+	var data []byte
+	var err error
+
+	switch c.ReportFormat {
+	case "junit":
+		data, err = junitReport(kind, results)
+	case "json":
+		data, err = json.MarshalIndent(newJSONReport(kind, results), "", "  ")
+	default:
+		return fmt.Errorf("unknown report format %q, expected one of junit or json", c.ReportFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(resolve(c.Dir, c.Report), append(data, '\n'), 0o644)
+}
+
+func junitReport(kind string, results []result) ([]byte, error) {
+	suite := junitTestSuite{
+		Name:  "wassert " + kind,
+		Tests: len(results),
+	}
+
+	var total time.Duration
+	for _, r := range results {
+		tc := junitTestCase{
+			Name:      r.Name,
+			Classname: "wassert." + kind,
+			Time:      seconds(r.Duration),
+		}
+		if r.Err != nil {
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: r.Err.Error(), Text: r.Err.Error()}
+		}
+		suite.Cases = append(suite.Cases, tc)
+		total += r.Duration
+	}
+	suite.Time = seconds(total)
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+func newJSONReport(kind string, results []result) jsonReport {
+	report := jsonReport{
+		Kind:    kind,
+		Tests:   len(results),
+		Results: []jsonResult{},
+	}
+
+	for _, r := range results {
+		jr := jsonResult{
+			Name:     r.Name,
+			Passed:   r.Err == nil,
+			Attempts: r.Attempts,
+			Duration: r.Duration.String(),
+		}
+		if r.Err != nil {
+			report.Failures++
+			jr.Failure = r.Err.Error()
+		}
+		report.Results = append(report.Results, jr)
+	}
+
+	return report
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
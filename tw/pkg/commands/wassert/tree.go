@@ -0,0 +1,402 @@
+package wassert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// maxExtraPaths caps how many unexpected paths are listed in a failure.
+const maxExtraPaths = 20
+
+type treeCfg struct {
+	Dir       string
+	Manifest  string
+	Update    bool
+	Checksums bool
+
+	root *cfg
+}
+
+type treeManifest struct {
+	// Exact requires every path in the tree to be listed in Paths or
+	// AllowExtra, otherwise the tree only has to contain at least Paths.
+	// Paths matching DenyExtra fail in either mode unless listed in Paths.
+	Exact      bool     `json:"exact,omitempty"`
+	AllowExtra []string `json:"allow_extra,omitempty"`
+	DenyExtra  []string `json:"deny_extra,omitempty"`
+
+	Paths []treeEntry `json:"paths"`
+}
+
+type treeEntry struct {
+	// Path is relative to the root and may be a glob, where * and ? don't
+	// cross directories and ** does. A glob must match at least one path
+	// and every path it matches is checked.
+	Path          string `json:"path"`
+	Type          string `json:"type,omitempty"`
+	Mode          string `json:"mode,omitempty"`
+	SymlinkTarget string `json:"symlink_target,omitempty"`
+	SHA256        string `json:"sha256,omitempty"`
+
+	tree *tree
+	glob *regexp.Regexp
+}
+
+// tree is a snapshot of every path below a root, relative to it. The root
+// itself is relative to dir.
+type tree struct {
+	dir   string
+	root  string
+	paths []string
+}
+
+func treeCommand(root *cfg) *cobra.Command {
+	cfg := &treeCfg{root: root}
+
+	cmd := &cobra.Command{
+		Use:   "tree",
+		Short: "Assert a directory tree matches a manifest",
+		Example: `
+  # Check a package's contents against its manifest
+  wassert tree --root /home/build/melange-out/foo --manifest foo.yaml
+
+  # Write the manifest from the tree as it is now
+  wassert tree --root /home/build/melange-out/foo --manifest foo.yaml --update --checksums
+		`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cfg.Run(cmd, args)
+		},
+	}
+
+	cmd.Flags().StringVar(&cfg.Dir, "root", ".", "Root of the tree to check")
+	cmd.Flags().StringVar(&cfg.Manifest, "manifest", "", "Manifest of the paths expected in the tree")
+	cmd.Flags().BoolVar(&cfg.Update, "update", false, "Write the manifest from the tree instead of checking it")
+	cmd.Flags().BoolVar(&cfg.Checksums, "checksums", false, "Include file checksums when writing the manifest with --update")
+	_ = cmd.MarkFlagRequired("manifest")
+
+	return cmd
+}
+
+func (c *treeCfg) Run(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	clog.InfoContext(ctx, "wassert tree", "root", c.Dir, "manifest", c.Manifest)
+
+	m := &treeManifest{}
+	if err := loadConfig(resolve(c.root.Dir, c.Manifest), m); err != nil && !(c.Update && os.IsNotExist(err)) {
+		return fmt.Errorf("failed to load manifest %s: %v", c.Manifest, err)
+	}
+
+	t, err := walkTree(ctx, c.root.Dir, c.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to walk %s: %v", c.Dir, err)
+	}
+
+	if c.Update {
+		return c.update(ctx, m, t)
+	}
+
+	entries := make([]assertion, 0, len(m.Paths)+1)
+	for i := range m.Paths {
+		e := &m.Paths[i]
+		e.tree = t
+		if e.glob, err = globRegexp(e.Path); err != nil {
+			return fmt.Errorf("invalid path %q in manifest: %v", e.Path, err)
+		}
+		entries = append(entries, e)
+	}
+
+	extra, err := newExtraPaths(m, t)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, extra)
+
+	return c.root.runAssertions(ctx, "tree", nil, entries)
+}
+
+// update rewrites the manifest from the tree, keeping its extra path
+// settings. Paths the manifest allows as extras are left out.
+func (c *treeCfg) update(ctx context.Context, m *treeManifest, t *tree) error {
+	allow, err := compileGlobs(m.AllowExtra)
+	if err != nil {
+		return err
+	}
+
+	m.Paths = []treeEntry{}
+	for _, p := range t.paths {
+		if matchesAny(allow, p) {
+			continue
+		}
+
+		e, err := c.manifestEntry(t, p)
+		if unreadable(err) {
+			clog.WarnContext(ctx, "skipping unreadable path", "path", filepath.Join(t.root, p), "err", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		m.Paths = append(m.Paths, e)
+	}
+
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(resolve(c.root.Dir, c.Manifest), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", c.Manifest, err)
+	}
+
+	clog.InfoContext(ctx, "wrote manifest", "manifest", c.Manifest, "paths", len(m.Paths))
+
+	return nil
+}
+
+// manifestEntry describes the path p in the tree as it is now.
+func (c *treeCfg) manifestEntry(t *tree, p string) (treeEntry, error) {
+	full := resolve(t.dir, filepath.Join(t.root, p))
+	fi, err := os.Lstat(full)
+	if err != nil {
+		return treeEntry{}, err
+	}
+
+	e := treeEntry{Path: p, Type: fileType(fi)}
+	switch e.Type {
+	case "symlink":
+		if e.SymlinkTarget, err = os.Readlink(full); err != nil {
+			return treeEntry{}, err
+		}
+	case "file":
+		if c.Checksums {
+			if e.SHA256, err = fileSHA256(full); err != nil {
+				return treeEntry{}, err
+			}
+		}
+		fallthrough
+	default:
+		e.Mode = fmt.Sprintf("%04o", modeBits(fi))
+	}
+
+	return e, nil
+}
+
+func (e *treeEntry) Name() string {
+	return e.Path
+}
+
+// The tree is walked once, so retrying would only see the same snapshot.
+func (e *treeEntry) retryPolicy() *eventually {
+	return nil
+}
+
+func (e *treeEntry) Assert(ctx context.Context) error {
+	matches := e.tree.match(e.glob)
+	if len(matches) == 0 {
+		return &assertError{msg: fmt.Sprintf("no path in %s matches %s", e.tree.root, e.Path)}
+	}
+
+	for _, p := range matches {
+		f := &fileEntry{
+			Path:          filepath.Join(e.tree.root, p),
+			dir:           e.tree.dir,
+			Type:          e.Type,
+			Mode:          e.Mode,
+			SymlinkTarget: e.SymlinkTarget,
+			SHA256:        e.SHA256,
+		}
+		if err := f.Assert(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extraPaths asserts on the paths in the tree that no manifest entry
+// accounts for.
+type extraPaths struct {
+	exact bool
+	tree  *tree
+
+	listed []*regexp.Regexp
+	allow  []*regexp.Regexp
+	deny   []*regexp.Regexp
+}
+
+func newExtraPaths(m *treeManifest, t *tree) (*extraPaths, error) {
+	x := &extraPaths{exact: m.Exact, tree: t}
+
+	var err error
+	for _, e := range m.Paths {
+		x.listed = append(x.listed, e.glob)
+	}
+	if x.allow, err = compileGlobs(m.AllowExtra); err != nil {
+		return nil, err
+	}
+	if x.deny, err = compileGlobs(m.DenyExtra); err != nil {
+		return nil, err
+	}
+
+	return x, nil
+}
+
+func (x *extraPaths) Name() string {
+	return "extra paths"
+}
+
+func (x *extraPaths) retryPolicy() *eventually {
+	return nil
+}
+
+func (x *extraPaths) Assert(ctx context.Context) error {
+	// Directories leading to a listed or allowed path don't need listing
+	// themselves
+	parents := map[string]bool{}
+	for _, p := range x.tree.paths {
+		if matchesAny(x.listed, p) || matchesAny(x.allow, p) {
+			for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+				parents[dir] = true
+			}
+		}
+	}
+
+	extra := []string{}
+	for _, p := range x.tree.paths {
+		if matchesAny(x.listed, p) {
+			continue
+		}
+
+		if matchesAny(x.deny, p) || (x.exact && !parents[p] && !matchesAny(x.allow, p)) {
+			extra = append(extra, p)
+		}
+	}
+
+	if len(extra) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("unexpected paths in %s: %s", x.tree.root, strings.Join(extra[:min(len(extra), maxExtraPaths)], ", "))
+	if len(extra) > maxExtraPaths {
+		msg += fmt.Sprintf(" (and %d more)", len(extra)-maxExtraPaths)
+	}
+
+	return &assertError{msg: msg}
+}
+
+// walkTree lists every path below root, which is relative to dir, without
+// following symlinks. Paths that vanish or can't be read below root, like those in /proc, are
+// skipped rather than failing the walk.
+func walkTree(ctx context.Context, dir, root string) (*tree, error) {
+	t := &tree{dir: dir, root: root}
+	top := resolve(dir, root)
+
+	err := filepath.WalkDir(top, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != top && unreadable(err) {
+				clog.WarnContext(ctx, "skipping unreadable path", "path", p, "err", err)
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(top, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			t.paths = append(t.paths, filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(t.paths)
+
+	return t, nil
+}
+
+// unreadable reports whether err is from a path that vanished or can't be
+// read, which a walk of a live system like / runs into.
+func unreadable(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
+func (t *tree) match(re *regexp.Regexp) []string {
+	matches := []string{}
+	for _, p := range t.paths {
+		if re.MatchString(p) {
+			matches = append(matches, p)
+		}
+	}
+	return matches
+}
+
+// globRegexp compiles a glob relative to the tree's root, where * and ?
+// stay within a directory and ** spans any number of them.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimPrefix(strings.TrimPrefix(glob, "./"), "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); {
+		// Step over whole runes so ? matches one character of a name and
+		// multi-byte ones are quoted as they are
+		c, size := utf8.DecodeRuneInString(glob[i:])
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			size = 3
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			size = 2
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+size]))
+		}
+		i += size
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, g := range globs {
+		re, err := globRegexp(g)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", g, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAny(res []*regexp.Regexp, p string) bool {
+	for _, re := range res {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
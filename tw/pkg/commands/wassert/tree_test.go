@@ -0,0 +1,203 @@
+package wassert
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		match []string
+		miss  []string
+	}{{
+		glob:  "usr/bin/foo",
+		match: []string{"usr/bin/foo"},
+		miss:  []string{"usr/bin/foobar", "usr/bin/foo/x"},
+	}, {
+		glob:  "/usr/bin/*",
+		match: []string{"usr/bin/foo", "usr/bin/bar"},
+		miss:  []string{"usr/bin", "usr/bin/sub/foo"},
+	}, {
+		glob:  "usr/lib/libfoo.so.?",
+		match: []string{"usr/lib/libfoo.so.1"},
+		miss:  []string{"usr/lib/libfoo.so.12", "usr/lib/libfooXso.1"},
+	}, {
+		glob:  "usr/**/*.so",
+		match: []string{"usr/a.so", "usr/lib/a.so", "usr/lib/x/y/a.so"},
+		miss:  []string{"a.so", "usr/lib/a.so.1"},
+	}, {
+		glob:  "./usr/share/**",
+		match: []string{"usr/share/doc", "usr/share/doc/foo/README"},
+		miss:  []string{"usr/lib"},
+	}, {
+		glob:  "usr/share/doc/café/*.txt",
+		match: []string{"usr/share/doc/café/README.txt", "usr/share/doc/café/ß.txt"},
+		miss:  []string{"usr/share/doc/cafe/README.txt", "usr/share/doc/caf/README.txt"},
+	}, {
+		glob:  "usr/share/locale/??/日本",
+		match: []string{"usr/share/locale/ja/日本", "usr/share/locale/éé/日本"},
+		miss:  []string{"usr/share/locale/jap/日本", "usr/share/locale/ja/日"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			re, err := globRegexp(tt.glob)
+			require.NoError(t, err)
+			for _, p := range tt.match {
+				require.True(t, re.MatchString(p), "%s should match %s", tt.glob, p)
+			}
+			for _, p := range tt.miss {
+				require.False(t, re.MatchString(p), "%s should not match %s", tt.glob, p)
+			}
+		})
+	}
+}
+
+func TestTreeMatching(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"usr/bin/foo", "usr/lib/libfoo.so.1.2", "usr/share/doc/foo/README"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(p)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, p), []byte("x"), 0o644))
+	}
+	require.NoError(t, os.Symlink("libfoo.so.1.2", filepath.Join(root, "usr/lib/libfoo.so.1")))
+
+	tr, err := walkTree(context.Background(), "", root)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"usr",
+		"usr/bin",
+		"usr/bin/foo",
+		"usr/lib",
+		"usr/lib/libfoo.so.1",
+		"usr/lib/libfoo.so.1.2",
+		"usr/share",
+		"usr/share/doc",
+		"usr/share/doc/foo",
+		"usr/share/doc/foo/README",
+	}, tr.paths)
+
+	entry := func(e treeEntry) *treeEntry {
+		e.tree = tr
+		e.glob, err = globRegexp(e.Path)
+		require.NoError(t, err)
+		return &e
+	}
+
+	tests := []struct {
+		name    string
+		entry   treeEntry
+		wantErr string
+	}{{
+		name:  "file",
+		entry: treeEntry{Path: "usr/bin/foo", Type: "file", Mode: "0644"},
+	}, {
+		name:  "glob",
+		entry: treeEntry{Path: "usr/*/libfoo.so.?.?", Type: "file"},
+	}, {
+		name:    "glob checks every match",
+		entry:   treeEntry{Path: "usr/**/foo", Type: "file"},
+		wantErr: "usr/share/doc/foo is a dir, not a file",
+	}, {
+		name:    "glob with a failing match",
+		entry:   treeEntry{Path: "usr/lib/*", Type: "file"},
+		wantErr: "is a symlink, not a file",
+	}, {
+		name:  "symlink",
+		entry: treeEntry{Path: "usr/lib/libfoo.so.1", Type: "symlink", SymlinkTarget: "libfoo.so.1.2"},
+	}, {
+		name:    "mode",
+		entry:   treeEntry{Path: "usr/bin/foo", Mode: "0755"},
+		wantErr: "has mode 0644, not 0755",
+	}, {
+		name:    "no match",
+		entry:   treeEntry{Path: "usr/bin/bar"},
+		wantErr: "no path in " + root + " matches usr/bin/bar",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := entry(tt.entry).Assert(context.Background())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	extraTests := []struct {
+		name     string
+		manifest treeManifest
+		wantErr  string
+	}{{
+		name:     "extras allowed when not exact",
+		manifest: treeManifest{Paths: []treeEntry{*entry(treeEntry{Path: "usr/bin/foo"})}},
+	}, {
+		name: "exact lists the extras",
+		manifest: treeManifest{
+			Exact: true,
+			Paths: []treeEntry{*entry(treeEntry{Path: "usr/bin/foo"}), *entry(treeEntry{Path: "usr/lib/*"})},
+		},
+		wantErr: "unexpected paths in " + root + ": usr/share, usr/share/doc, usr/share/doc/foo, usr/share/doc/foo/README",
+	}, {
+		name: "exact with allowed extras",
+		manifest: treeManifest{
+			Exact:      true,
+			AllowExtra: []string{"usr/share/**"},
+			Paths:      []treeEntry{*entry(treeEntry{Path: "usr/bin/foo"}), *entry(treeEntry{Path: "usr/lib/*"})},
+		},
+	}, {
+		name: "denied extras fail when not exact",
+		manifest: treeManifest{
+			DenyExtra: []string{"**/README"},
+			Paths:     []treeEntry{*entry(treeEntry{Path: "usr/bin/foo"})},
+		},
+		wantErr: "unexpected paths in " + root + ": usr/share/doc/foo/README",
+	}, {
+		name: "denied extras listed in paths pass",
+		manifest: treeManifest{
+			DenyExtra: []string{"**/README"},
+			Paths:     []treeEntry{*entry(treeEntry{Path: "usr/share/doc/foo/README"})},
+		},
+	}}
+
+	for _, tt := range extraTests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := newExtraPaths(&tt.manifest, tr)
+			require.NoError(t, err)
+
+			err = x.Assert(context.Background())
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestWalkTreeSkipsUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any directory")
+	}
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/foo"), []byte("x"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "secret/inner"), 0o755))
+	require.NoError(t, os.Chmod(filepath.Join(root, "secret"), 0))
+	t.Cleanup(func() { _ = os.Chmod(filepath.Join(root, "secret"), 0o755) })
+
+	tr, err := walkTree(context.Background(), "", root)
+	require.NoError(t, err)
+	require.Equal(t, []string{"secret", "usr", "usr/bin", "usr/bin/foo"}, tr.paths)
+
+	_, err = walkTree(context.Background(), "", filepath.Join(root, "missing"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -1,26 +1,230 @@
 package wassert
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/chainguard-dev/clog"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 )
 
-type cfg struct{}
+type cfg struct {
+	Dir          string
+	Report       string
+	ReportFormat string
+}
 
 func Command() *cobra.Command {
 	cfg := &cfg{}
-	_ = cfg
 
 	cmd := &cobra.Command{
 		Use: "wassert",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.ReportFormat != "junit" && cfg.ReportFormat != "json" {
+				return fmt.Errorf("unknown report format %q, expected one of junit or json", cfg.ReportFormat)
+			}
+			return nil
+		},
 	}
 
-	cmd.AddCommand(fileCommand())
+	cmd.PersistentFlags().StringVarP(&cfg.Dir, "dir", "C", "", "Directory to resolve relative paths against instead of the current one")
+	cmd.PersistentFlags().StringVar(&cfg.Report, "report", "", "File to write a report of every assertion's result to")
+	cmd.PersistentFlags().StringVar(&cfg.ReportFormat, "report-format", "junit", "Format of the --report file, one of junit or json")
+
+	cmd.AddCommand(
+		fileCommand(cfg),
+		commandCommand(cfg),
+		docCommand(cfg),
+		treeCommand(cfg),
+	)
 
 	return cmd
 }
 
+// assertion is a single config entry that can be asserted on.
+type assertion interface {
+	// Name identifies the entry in logs and reports.
+	Name() string
+	Assert(ctx context.Context) error
+	retryPolicy() *eventually
+}
+
+// config is the config of a subcommand that loads its entries from a file.
+type config interface {
+	// reset clears everything a previous load set.
+	reset()
+}
+
+// reload loads the config at path into cfg, after clearing what a previous
+// run loaded so its entries don't bleed into this one.
+func reload(path string, cfg config) error {
+	cfg.reset()
+	return loadConfig(path, cfg)
+}
+
+// resolve returns p relative to dir. Absolute paths, empty ones and any
+// path when dir isn't set are returned as they are.
+func resolve(dir, p string) string {
+	if dir == "" || p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// loadConfig unmarshals the YAML config at path into cfg.
+func loadConfig(path string, cfg any) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(data, cfg)
+}
+
+// runAssertions asserts every entry rather than stopping at the first
+// failure, so a single run reports everything that is wrong. The report is
+// written however the run ends, with the last result of each entry.
+func (c *cfg) runAssertions(ctx context.Context, kind string, global *eventually, entries []assertion) error {
+	results := make([]result, len(entries))
+	for i, e := range entries {
+		results[i].Name = e.Name()
+	}
+
+	err := assertAll(ctx, global, entries, results)
+
+	if c.Report != "" {
+		if err := c.writeReport(kind, results); err != nil {
+			return fmt.Errorf("failed to write report %s: %v", c.Report, err)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			return fmt.Errorf("%s assertion failed", kind)
+		}
+	}
+
+	clog.InfoContext(ctx, "all assertions passed")
+
+	return nil
+}
+
+// assertAll asserts the whole set of entries in rounds, recording each
+// entry's latest attempt in results. While every failing entry has an
+// eventually policy, its own or the config's global one, with time left,
+// the set is asserted again, so an entry that passed earlier has to still
+// pass once everything does.
+func assertAll(ctx context.Context, global *eventually, entries []assertion, results []result) error {
+	start := time.Now()
+
+	for {
+		failed := []int{}
+		retry := true
+		var wait time.Duration
+
+		for i, e := range entries {
+			attemptStart := time.Now()
+			err := e.Assert(ctx)
+			results[i].Err = err
+			results[i].Attempts++
+			results[i].Duration += time.Since(attemptStart)
+
+			if err == nil {
+				continue
+			}
+			failed = append(failed, i)
+
+			policy := e.retryPolicy()
+			if policy == nil {
+				policy = global
+			}
+
+			var left time.Duration
+			if policy != nil {
+				left = time.Until(start.Add(policy.Timeout.Duration))
+			}
+			if left <= 0 {
+				retry = false
+				continue
+			}
+
+			next := min(policy.interval(), left)
+			if wait == 0 || next < wait {
+				wait = next
+			}
+		}
+
+		if len(failed) == 0 {
+			return nil
+		}
+
+		if !retry {
+			for _, i := range failed {
+				clog.ErrorContext(ctx, "assertion failed", "name", results[i].Name, "err", results[i].Err)
+			}
+			return nil
+		}
+
+		for _, i := range failed {
+			clog.InfoContext(ctx, "assertion failed, retrying", "name", results[i].Name, "attempt", results[i].Attempts, "err", results[i].Err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// eventually retries a failing assertion until it passes or Timeout runs
+// out, for things like logs and pidfiles that are written asynchronously.
+type eventually struct {
+	Timeout  duration `json:"timeout"`
+	Interval duration `json:"interval"`
+}
+
+func (e *eventually) interval() time.Duration {
+	if e.Interval.Duration <= 0 {
+		return time.Second
+	}
+	return e.Interval.Duration
+}
+
+// entryOptions are the options every kind of entry accepts.
+type entryOptions struct {
+	// Eventually overrides the config's global eventually for this entry.
+	Eventually *eventually `json:"eventually"`
+}
+
+func (o *entryOptions) retryPolicy() *eventually {
+	return o.Eventually
+}
+
+// assertError is an assertion that didn't hold, as opposed to a failure
+// to run wassert itself.
+type assertError struct {
+	msg string
+}
+
+func (e *assertError) Error() string {
+	return e.msg
+}
+
 func lineMatches(line string, expects ...string) bool {
 	for _, expect := range expects {
 		if strings.Contains(line, expect) {
@@ -29,3 +233,27 @@ func lineMatches(line string, expects ...string) bool {
 	}
 	return false
 }
+
+// duration is a time.Duration that unmarshals from strings like "30s".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, expected a string like \"30s\"", b)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
@@ -0,0 +1,121 @@
+package wassert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAssertion fails the attempts listed in fail, counting from 1.
+type fakeAssertion struct {
+	name     string
+	fail     map[int]bool
+	policy   *eventually
+	attempts int
+}
+
+func (f *fakeAssertion) Name() string { return f.name }
+
+func (f *fakeAssertion) Assert(context.Context) error {
+	f.attempts++
+	if f.fail[f.attempts] {
+		return &assertError{msg: f.name + " failed"}
+	}
+	return nil
+}
+
+func (f *fakeAssertion) retryPolicy() *eventually { return f.policy }
+
+func TestRunAssertionsRetriesWholeSet(t *testing.T) {
+	global := &eventually{Timeout: duration{time.Second}, Interval: duration{10 * time.Millisecond}}
+
+	// flaky passes, then breaks once slow starts passing, so the set only
+	// passes on the fourth round
+	slow := &fakeAssertion{name: "slow", fail: map[int]bool{1: true, 2: true}}
+	flaky := &fakeAssertion{name: "flaky", fail: map[int]bool{3: true}}
+
+	c := &cfg{Report: filepath.Join(t.TempDir(), "report.json"), ReportFormat: "json"}
+	require.NoError(t, c.runAssertions(context.Background(), "file", global, []assertion{slow, flaky}))
+	require.Equal(t, 4, slow.attempts)
+	require.Equal(t, 4, flaky.attempts)
+
+	// An entry without a policy fails the set straight away
+	broken := &fakeAssertion{name: "broken", fail: map[int]bool{1: true, 2: true}}
+	ok := &fakeAssertion{name: "ok"}
+	require.EqualError(t, c.runAssertions(context.Background(), "file", nil, []assertion{broken, ok}), "file assertion failed")
+	require.Equal(t, 1, broken.attempts)
+}
+
+func TestRunAssertionsReportsOnCancel(t *testing.T) {
+	report := filepath.Join(t.TempDir(), "report.json")
+	c := &cfg{Report: report, ReportFormat: "json"}
+
+	never := &fakeAssertion{
+		name:   "never",
+		fail:   map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true},
+		policy: &eventually{Timeout: duration{time.Minute}, Interval: duration{time.Minute}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := c.runAssertions(ctx, "file", nil, []assertion{never})
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+
+	data, err := os.ReadFile(report)
+	require.NoError(t, err)
+
+	var r jsonReport
+	require.NoError(t, json.Unmarshal(data, &r))
+	require.Equal(t, 1, r.Failures)
+	require.Equal(t, "never failed", r.Results[0].Failure)
+	require.Equal(t, 1, r.Results[0].Attempts)
+}
+
+func TestCommandDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"foo.txt":  "hello world\n",
+		"app.json": `{"port": 8080}`,
+		"file.yaml": `files:
+- path: foo.txt
+  contains: hello
+`,
+		"command.yaml": `commands:
+- cmd: cat foo.txt
+  stdout:
+    contains: hello
+`,
+		"doc.yaml": `docs:
+- file: app.json
+  path: .port
+  equals: 8080
+`,
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+
+	// Relative paths in the flags and the configs are all resolved against
+	// --dir rather than the working directory
+	for _, args := range [][]string{
+		{"file", "-f", "file.yaml", "--report", "file.xml"},
+		{"command", "-f", "command.yaml"},
+		{"doc", "-f", "doc.yaml"},
+		{"tree", "--manifest", "tree.yaml", "--update"},
+		{"tree", "--manifest", "tree.yaml"},
+	} {
+		cmd := Command()
+		cmd.SetArgs(append([]string{"--dir", dir}, args...))
+		require.NoError(t, cmd.ExecuteContext(context.Background()), "%v", args)
+	}
+
+	require.FileExists(t, filepath.Join(dir, "file.xml"))
+	require.FileExists(t, filepath.Join(dir, "tree.yaml"))
+}
@@ -0,0 +1,204 @@
+// Package logmatch holds the log grepping logic shared by dgrep and kgrep.
+package logmatch
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+// DefaultErrorPatterns are checked as not-expected with --std-errors.
+var DefaultErrorPatterns = []string{
+	"ERROR",
+	"FATAL",
+	"FAIL",
+	"Exception",
+	"panic",
+	"Traceback",
+	"command not found",
+	"java.lang.*Exception",
+	"NullPointerException",
+	"RuntimeException",
+	"TimeoutException",
+	"OutOfMemoryError",
+	"StackOverflow",
+	"segmentation fault",
+	"org.jruby.exceptions",
+	"Gem::MissingSpecError",
+	"Permission denied",
+}
+
+// thresholds matches the ":min=N,max=M" suffix of a pattern.
+var thresholds = regexp.MustCompile(`:((?:min|max)=\d+(?:,(?:min|max)=\d+)?)$`)
+
+// Config is the pattern matching configuration shared by dgrep and kgrep.
+type Config struct {
+	Patterns           []string
+	NotExpected        []string
+	NotExpectedExclude []string
+	IgnoreCase         bool
+	InvertMatch        bool
+	DefaultErrors      bool
+	Before             int
+	After              int
+	Context            int
+	Stream             string
+	Output             string
+
+	expected    []*Pattern
+	notExpected []*Pattern
+}
+
+// Pattern is a compiled -e or --ne pattern and how many lines may match it.
+type Pattern struct {
+	Expr string
+	Min  int
+	// Max is -1 when any number of lines may match.
+	Max int
+
+	re *regexp.Regexp
+}
+
+// AddFlags registers the matching flags. IgnoreCase's current value is
+// used as the default for -i.
+func (c *Config) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&c.IgnoreCase, "ignore-case", "i", c.IgnoreCase, "toggle to ignore case for the match")
+	cmd.Flags().StringArrayVarP(&c.Patterns, "regexp", "e", nil, "regular expression to match that must be present, optionally suffixed with :min=N,max=M to bound how many lines match")
+	cmd.Flags().StringArrayVar(&c.NotExpected, "ne", nil, "regular expression that must NOT be present, optionally suffixed with :max=N to tolerate up to N lines")
+	cmd.Flags().StringArrayVar(&c.NotExpectedExclude, "ne-exclude", nil, "exclude specific patterns from --std-errors (only works with --std-errors)")
+	cmd.Flags().BoolVar(&c.DefaultErrors, "std-errors", false, fmt.Sprintf("check for %d standard error patterns", len(DefaultErrorPatterns)))
+	cmd.Flags().BoolVarP(&c.InvertMatch, "invert-match", "v", false, "toggle to invert the match")
+	cmd.Flags().IntVarP(&c.After, "after-context", "A", 0, "print NUM lines of trailing context after each match")
+	cmd.Flags().IntVarP(&c.Before, "before-context", "B", 0, "print NUM lines of leading context before each match")
+	cmd.Flags().IntVarP(&c.Context, "context", "C", 0, "print NUM lines of context around each match")
+	cmd.Flags().StringVar(&c.Stream, "stream", "", "only match lines from this stream, stdout or stderr")
+	cmd.Flags().StringVarP(&c.Output, "output", "o", "text", "output format (text, json)")
+}
+
+// Compile validates the flags and compiles the patterns.
+func (c *Config) Compile() error {
+	// Validate --ne-exclude requires --std-errors
+	if len(c.NotExpectedExclude) > 0 && !c.DefaultErrors {
+		return fmt.Errorf("--ne-exclude can only be used with --std-errors")
+	}
+
+	notExpected := slices.Clone(c.NotExpected)
+	if c.DefaultErrors {
+		for _, p := range DefaultErrorPatterns {
+			if !slices.Contains(c.NotExpectedExclude, p) {
+				notExpected = append(notExpected, p)
+			}
+		}
+	}
+
+	if len(c.Patterns) == 0 && len(notExpected) == 0 {
+		return fmt.Errorf("expected at least one pattern via -e/--regexp or --ne")
+	}
+
+	switch c.Stream {
+	case "", "stdout", "stderr":
+	default:
+		return fmt.Errorf("invalid --stream %q, expected stdout or stderr", c.Stream)
+	}
+
+	switch c.Output {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("invalid output format: %s", c.Output)
+	}
+
+	if c.Before < 0 || c.After < 0 || c.Context < 0 {
+		return fmt.Errorf("context line counts can't be negative")
+	}
+	if c.Before == 0 {
+		c.Before = c.Context
+	}
+	if c.After == 0 {
+		c.After = c.Context
+	}
+
+	c.expected = nil
+	for _, s := range c.Patterns {
+		p, err := c.parsePattern(s, 1, -1)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", s, err)
+		}
+		c.expected = append(c.expected, p)
+	}
+
+	c.notExpected = nil
+	for _, s := range notExpected {
+		p, err := c.parsePattern(s, 0, 0)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", s, err)
+		}
+		if p.Min > 0 {
+			return fmt.Errorf("invalid pattern %q: min can't be used with --ne", s)
+		}
+		c.notExpected = append(c.notExpected, p)
+	}
+
+	// Check for conflicting patterns (same pattern in both -e and --ne)
+	for _, e := range c.expected {
+		for _, ne := range c.notExpected {
+			if e.Expr == ne.Expr {
+				return fmt.Errorf("conflicting pattern '%s' found in both -e and --ne flags", e.Expr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parsePattern splits off an optional ":min=N,max=M" suffix and compiles
+// the rest of s.
+func (c *Config) parsePattern(s string, minCount, maxCount int) (*Pattern, error) {
+	p := &Pattern{Expr: s, Min: minCount, Max: maxCount}
+
+	if m := thresholds.FindStringSubmatchIndex(s); m != nil {
+		p.Expr = s[:m[0]]
+		for _, kv := range strings.Split(s[m[2]:m[3]], ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			if k == "min" {
+				p.Min = n
+			} else {
+				p.Max = n
+			}
+		}
+	}
+
+	if p.Max >= 0 && p.Min > p.Max {
+		return nil, fmt.Errorf("min=%d is more than max=%d", p.Min, p.Max)
+	}
+
+	expr := p.Expr
+	if c.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+
+	return p, nil
+}
+
+// Highlight marks the matched part of a line, in color on a terminal.
+func Highlight(s string) string {
+	if isatty.IsTerminal(os.Stdout.Fd()) {
+		return "\x1b[32;1m" + s + "\x1b[0m"
+	}
+	return "( " + s + " )"
+}
@@ -0,0 +1,231 @@
+package logmatch
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// Line is a single log line.
+type Line struct {
+	// Source names where the line came from, like a container or pod.
+	Source string
+	// Stream is stdout or stderr, or empty when the runtime doesn't say.
+	Stream    string
+	Timestamp time.Time
+	Text      string
+}
+
+// Match is a line matching a pattern, with its context lines.
+type Match struct {
+	// Pattern indexes the expected or not-expected patterns, depending on
+	// which list the match is in.
+	Pattern   int       `json:"pattern"`
+	Source    string    `json:"source"`
+	Stream    string    `json:"stream,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	Text      string    `json:"text"`
+	Before    []string  `json:"before,omitempty"`
+	After     []string  `json:"after,omitempty"`
+}
+
+// Matcher checks the lines of one target against a compiled Config.
+type Matcher struct {
+	Matches     []*Match
+	NotExpected []*Match
+
+	cfg    *Config
+	target string
+
+	counts   []int
+	neCounts []int
+
+	// history holds the last lines of each source and stream for
+	// --before-context, pending the matches still collecting
+	// --after-context.
+	history map[string][]string
+	pending map[string][]*pendingMatch
+}
+
+type pendingMatch struct {
+	match *Match
+	left  int
+}
+
+// NewMatcher returns a Matcher for target, which names what's grepped in
+// messages. Compile must have been called.
+func (c *Config) NewMatcher(target string) *Matcher {
+	return &Matcher{
+		cfg:      c,
+		target:   target,
+		counts:   make([]int, len(c.expected)),
+		neCounts: make([]int, len(c.notExpected)),
+		history:  map[string][]string{},
+		pending:  map[string][]*pendingMatch{},
+	}
+}
+
+// Add checks a line against every pattern. Lines from a stream other than
+// --stream are skipped.
+func (m *Matcher) Add(l Line) {
+	if m.cfg.Stream != "" && l.Stream != "" && l.Stream != m.cfg.Stream {
+		return
+	}
+
+	key := l.Source + "\x00" + l.Stream
+
+	pending := m.pending[key][:0]
+	for _, p := range m.pending[key] {
+		p.match.After = append(p.match.After, l.Text)
+		if p.left--; p.left > 0 {
+			pending = append(pending, p)
+		}
+	}
+	m.pending[key] = pending
+
+	before := slices.Clone(m.history[key])
+	for i, p := range m.cfg.expected {
+		if p.re.MatchString(l.Text) {
+			m.counts[i]++
+			m.Matches = append(m.Matches, m.newMatch(key, i, l, before))
+		}
+	}
+	for i, p := range m.cfg.notExpected {
+		if p.re.MatchString(l.Text) {
+			m.neCounts[i]++
+			m.NotExpected = append(m.NotExpected, m.newMatch(key, i, l, before))
+		}
+	}
+
+	if m.cfg.Before > 0 {
+		h := append(m.history[key], l.Text)
+		if len(h) > m.cfg.Before {
+			h = h[len(h)-m.cfg.Before:]
+		}
+		m.history[key] = h
+	}
+}
+
+func (m *Matcher) newMatch(key string, pattern int, l Line, before []string) *Match {
+	match := &Match{
+		Pattern:   pattern,
+		Source:    l.Source,
+		Stream:    l.Stream,
+		Timestamp: l.Timestamp,
+		Text:      l.Text,
+		Before:    before,
+	}
+	if m.cfg.After > 0 {
+		m.pending[key] = append(m.pending[key], &pendingMatch{match: match, left: m.cfg.After})
+	}
+	return match
+}
+
+// Failed returns an error once the lines added so far can't pass anymore:
+// an unwanted or not-expected match, or a pattern matching more than its
+// max.
+func (m *Matcher) Failed() error {
+	if m.cfg.InvertMatch && len(m.Matches) > 0 {
+		return fmt.Errorf("found %d unwanted matches in %s", len(m.Matches), m.target)
+	}
+
+	over := 0
+	for i, p := range m.cfg.notExpected {
+		if m.neCounts[i] > p.Max {
+			over += m.neCounts[i]
+		}
+	}
+	if over > 0 {
+		return fmt.Errorf("found %d not-expected matches in %s", over, m.target)
+	}
+
+	for i, p := range m.cfg.expected {
+		if p.Max >= 0 && m.counts[i] > p.Max {
+			return fmt.Errorf("pattern %q matched %d times in %s, more than max=%d", p.Expr, m.counts[i], m.target, p.Max)
+		}
+	}
+
+	return nil
+}
+
+// Missing returns the expected patterns that matched fewer than their min.
+func (m *Matcher) Missing() []string {
+	if m.cfg.InvertMatch {
+		return nil
+	}
+
+	var missing []string
+	for i, p := range m.cfg.expected {
+		if m.counts[i] < p.Min {
+			missing = append(missing, p.Expr)
+		}
+	}
+	return missing
+}
+
+// Satisfied reports whether there are expected patterns and each has
+// matched at least its min, so following the logs can stop.
+func (m *Matcher) Satisfied() bool {
+	return !m.cfg.InvertMatch && len(m.cfg.expected) > 0 && len(m.Missing()) == 0
+}
+
+// Collecting reports whether a match is still waiting on --after-context
+// lines.
+func (m *Matcher) Collecting() bool {
+	for _, p := range m.pending {
+		if len(p) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the outcome once every line has been added.
+func (m *Matcher) Err() error {
+	if err := m.Failed(); err != nil {
+		return err
+	}
+
+	if m.cfg.InvertMatch {
+		return nil
+	}
+
+	for i, p := range m.cfg.expected {
+		if m.counts[i] > 0 && m.counts[i] < p.Min {
+			return fmt.Errorf("pattern %q matched %d times in %s, fewer than min=%d", p.Expr, m.counts[i], m.target, p.Min)
+		}
+	}
+
+	if missing := m.Missing(); len(missing) > 0 {
+		return fmt.Errorf("no match found for expected pattern(s): %v", missing)
+	}
+
+	return nil
+}
+
+// Log prints the matches with their context.
+func (m *Matcher) Log(ctx context.Context) {
+	clog.InfoContextf(ctx, "found %d expected matches in %s", len(m.Matches), m.target)
+	logMatches(ctx, "expected", m.cfg.expected, m.Matches)
+
+	if len(m.NotExpected) > 0 {
+		clog.InfoContextf(ctx, "found %d not-expected matches in %s", len(m.NotExpected), m.target)
+		logMatches(ctx, "not-expected", m.cfg.notExpected, m.NotExpected)
+	}
+}
+
+func logMatches(ctx context.Context, kind string, patterns []*Pattern, matches []*Match) {
+	for i, match := range matches {
+		for _, l := range match.Before {
+			clog.InfoContextf(ctx, "   | %s", l)
+		}
+		text := patterns[match.Pattern].re.ReplaceAllStringFunc(match.Text, Highlight)
+		clog.InfoContextf(ctx, "-- [%d/%d] %s in %s: %s", i+1, len(matches), kind, match.Source, text)
+		for _, l := range match.After {
+			clog.InfoContextf(ctx, "   | %s", l)
+		}
+	}
+}
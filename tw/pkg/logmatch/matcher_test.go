@@ -0,0 +1,218 @@
+package logmatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		in      string
+		expr    string
+		min     int
+		max     int
+		wantErr bool
+	}{
+		{in: "ready", expr: "ready", min: 1, max: -1},
+		{in: "ready:min=3", expr: "ready", min: 3, max: -1},
+		{in: "ready:max=2", expr: "ready", min: 1, max: 2},
+		{in: "ready:min=0,max=1", expr: "ready", min: 0, max: 1},
+		{in: "host:8080", expr: "host:8080", min: 1, max: -1},
+		{in: "a:min=x", expr: "a:min=x", min: 1, max: -1},
+		{in: "ready:min=3,max=2", wantErr: true},
+		{in: "(:min=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			p, err := (&Config{}).parsePattern(tt.in, 1, -1)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expr, p.Expr)
+			require.Equal(t, tt.min, p.Min)
+			require.Equal(t, tt.max, p.Max)
+		})
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	lines := []Line{
+		{Stream: "stdout", Text: "starting"},
+		{Stream: "stderr", Text: "warning: slow disk"},
+		{Stream: "stdout", Text: "ready"},
+		{Stream: "stdout", Text: "serving"},
+		{Stream: "stderr", Text: "warning: slow disk"},
+		{Stream: "stdout", Text: "ready"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		matches int
+		wantErr string
+	}{
+		{
+			name:    "counts every match",
+			cfg:     Config{Patterns: []string{"ready:min=2"}},
+			matches: 2,
+		},
+		{
+			name:    "below min",
+			cfg:     Config{Patterns: []string{"ready:min=3"}},
+			matches: 2,
+			wantErr: `pattern "ready" matched 2 times in test, fewer than min=3`,
+		},
+		{
+			name:    "above max",
+			cfg:     Config{Patterns: []string{"ready:max=1"}},
+			matches: 2,
+			wantErr: `pattern "ready" matched 2 times in test, more than max=1`,
+		},
+		{
+			name:    "missing",
+			cfg:     Config{Patterns: []string{"ready", "done"}},
+			matches: 2,
+			wantErr: "no match found for expected pattern(s): [done]",
+		},
+		{
+			name:    "not expected",
+			cfg:     Config{NotExpected: []string{"warning"}},
+			wantErr: "found 2 not-expected matches in test",
+		},
+		{
+			name: "not expected within max",
+			cfg:  Config{NotExpected: []string{"warning:max=2"}},
+		},
+		{
+			name:    "stream filter",
+			cfg:     Config{NotExpected: []string{"warning"}, Stream: "stdout"},
+			matches: 0,
+		},
+		{
+			name:    "invert",
+			cfg:     Config{Patterns: []string{"ready"}, InvertMatch: true},
+			matches: 2,
+			wantErr: "found 2 unwanted matches in test",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cfg
+			require.NoError(t, c.Compile())
+
+			m := c.NewMatcher("test")
+			for _, l := range lines {
+				m.Add(l)
+			}
+
+			require.Len(t, m.Matches, tt.matches)
+			if tt.wantErr != "" {
+				require.EqualError(t, m.Err(), tt.wantErr)
+			} else {
+				require.NoError(t, m.Err())
+			}
+		})
+	}
+}
+
+func TestMatcherContext(t *testing.T) {
+	c := &Config{Patterns: []string{"ready"}, Context: 1}
+	require.NoError(t, c.Compile())
+
+	m := c.NewMatcher("test")
+	for _, l := range []Line{
+		{Source: "a", Text: "starting"},
+		{Source: "b", Text: "other"},
+		{Source: "a", Text: "ready"},
+		{Source: "b", Text: "noise"},
+		{Source: "a", Text: "serving"},
+		{Source: "a", Text: "done"},
+	} {
+		m.Add(l)
+	}
+
+	require.Len(t, m.Matches, 1)
+	require.Equal(t, []string{"starting"}, m.Matches[0].Before)
+	require.Equal(t, []string{"serving"}, m.Matches[0].After)
+	require.False(t, m.Collecting())
+}
+
+func TestMatcherCollecting(t *testing.T) {
+	c := &Config{Patterns: []string{"ready"}, After: 2}
+	require.NoError(t, c.Compile())
+
+	m := c.NewMatcher("test")
+	m.Add(Line{Source: "a", Text: "ready"})
+	require.True(t, m.Collecting())
+
+	m.Add(Line{Source: "b", Text: "other"})
+	m.Add(Line{Source: "a", Text: "serving"})
+	require.True(t, m.Collecting())
+
+	m.Add(Line{Source: "a", Text: "done"})
+	require.False(t, m.Collecting())
+	require.Equal(t, []string{"serving", "done"}, m.Matches[0].After)
+}
+
+func TestCompile(t *testing.T) {
+	for _, c := range []*Config{
+		{},
+		{NotExpectedExclude: []string{"ERROR"}},
+		{Patterns: []string{"ERROR"}, DefaultErrors: true},
+		{Patterns: []string{"ready"}, Stream: "both"},
+		{NotExpected: []string{"warning:min=1"}},
+		{Patterns: []string{"ready"}, After: -1},
+	} {
+		require.Error(t, c.Compile(), "%+v", c)
+	}
+
+	c := &Config{DefaultErrors: true, NotExpectedExclude: []string{"ERROR"}}
+	require.NoError(t, c.Compile())
+	require.Len(t, c.notExpected, len(DefaultErrorPatterns)-1)
+}
+
+func TestReport(t *testing.T) {
+	c := &Config{Patterns: []string{"ready:max=1", "done"}, NotExpected: []string{"warning"}}
+	require.NoError(t, c.Compile())
+
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := c.NewMatcher("container app")
+	m.Add(Line{Source: "app", Stream: "stdout", Timestamp: ts, Text: "ready"})
+	m.Add(Line{Source: "app", Stream: "stderr", Text: "warning: slow"})
+
+	r := m.Report(m.Err())
+	require.False(t, r.Passed)
+	require.Equal(t, "found 1 not-expected matches in container app", r.Error)
+
+	require.Len(t, r.Patterns, 2)
+	require.Equal(t, "ready", r.Patterns[0].Pattern)
+	require.Equal(t, 1, *r.Patterns[0].Max)
+	require.True(t, r.Patterns[0].Matched)
+	require.Equal(t, []*Match{{Pattern: 0, Source: "app", Stream: "stdout", Timestamp: ts, Text: "ready"}}, r.Patterns[0].Matches)
+	require.Nil(t, r.Patterns[1].Max)
+	require.False(t, r.Patterns[1].Matched)
+	require.Empty(t, r.Patterns[1].Matches)
+
+	require.Len(t, r.NotExpected, 1)
+	require.Equal(t, 1, r.NotExpected[0].Count)
+	require.Equal(t, "stderr", r.NotExpected[0].Matches[0].Stream)
+
+	var reports Reports
+	reports.Add(&Report{Target: "pod app"})
+	reports.Add(r)
+	var buf bytes.Buffer
+	require.NoError(t, reports.Write(&buf))
+
+	var got []Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, "pod app", got[1].Target)
+	require.Equal(t, "2025-01-01T12:00:00Z", got[0].Patterns[0].Matches[0].Timestamp.Format(time.RFC3339))
+}
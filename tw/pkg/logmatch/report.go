@@ -0,0 +1,110 @@
+package logmatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Report is the --output json result of grepping one target.
+type Report struct {
+	Target      string          `json:"target"`
+	Passed      bool            `json:"passed"`
+	Error       string          `json:"error,omitempty"`
+	Patterns    []PatternReport `json:"patterns"`
+	NotExpected []PatternReport `json:"not_expected"`
+}
+
+// PatternReport is how often a single pattern matched.
+type PatternReport struct {
+	Pattern string `json:"pattern"`
+	Min     int    `json:"min"`
+	// Max is left out when any number of lines may match.
+	Max     *int     `json:"max,omitempty"`
+	Matched bool     `json:"matched"`
+	Count   int      `json:"count"`
+	Matches []*Match `json:"matches"`
+}
+
+// Report summarizes the matches, with err as the outcome of the grep.
+func (m *Matcher) Report(err error) *Report {
+	r := &Report{
+		Target:      m.target,
+		Passed:      err == nil,
+		Patterns:    patternReports(m.cfg.expected, m.counts, m.Matches),
+		NotExpected: patternReports(m.cfg.notExpected, m.neCounts, m.NotExpected),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func patternReports(patterns []*Pattern, counts []int, matches []*Match) []PatternReport {
+	reports := make([]PatternReport, 0, len(patterns))
+	for i, p := range patterns {
+		pr := PatternReport{
+			Pattern: p.Expr,
+			Min:     p.Min,
+			Matched: counts[i] > 0,
+			Count:   counts[i],
+			Matches: []*Match{},
+		}
+		if p.Max >= 0 {
+			pr.Max = &p.Max
+		}
+		for _, match := range matches {
+			if match.Pattern == i {
+				pr.Matches = append(pr.Matches, match)
+			}
+		}
+		reports = append(reports, pr)
+	}
+	return reports
+}
+
+// Reports collects the reports of the targets grepped concurrently in a
+// single attempt.
+type Reports struct {
+	mu      sync.Mutex
+	reports []*Report
+}
+
+// Add records a target's report.
+func (r *Reports) Add(report *Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+}
+
+// Reset drops the reports of a previous attempt.
+func (r *Reports) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = nil
+}
+
+// Write prints the reports as JSON, sorted by target.
+func (r *Reports) Write(w io.Writer) error {
+	r.mu.Lock()
+	reports := slices.Clone(r.reports)
+	r.mu.Unlock()
+
+	if reports == nil {
+		reports = []*Report{}
+	}
+	slices.SortFunc(reports, func(a, b *Report) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(reports); err != nil {
+		return fmt.Errorf("failed to encode json: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package logmatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Window limits grepping to the log lines written within a time range, and
+// optionally to the lines newer than those a previous run already saw. The
+// checkpoint is kept per source, since sources are read at their own pace
+// and may stop being read once their patterns match.
+type Window struct {
+	Since      string
+	Until      string
+	Checkpoint string
+
+	since time.Time
+	until time.Time
+
+	// checkpoint is the newest timestamp a previous run saw by source
+	checkpoint map[string]time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// AddFlags registers the --since, --until and --checkpoint flags.
+func (w *Window) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&w.Since, "since", "", "only grep lines newer than a relative duration like 5m or an RFC3339 timestamp")
+	cmd.Flags().StringVar(&w.Until, "until", "", "only grep lines older than a relative duration like 5m or an RFC3339 timestamp")
+	cmd.Flags().StringVar(&w.Checkpoint, "checkpoint", "", "file recording the last log timestamp seen from each container, so the next run only greps newer lines")
+}
+
+// Resolve parses the flags relative to now and reads the checkpoint, which
+// narrows --since when it's more recent.
+func (w *Window) Resolve(now time.Time) error {
+	var err error
+	if w.since, err = parseTime(w.Since, now); err != nil {
+		return fmt.Errorf("invalid --since: %v", err)
+	}
+	if w.until, err = parseTime(w.Until, now); err != nil {
+		return fmt.Errorf("invalid --until: %v", err)
+	}
+	if !w.since.IsZero() && !w.until.IsZero() && !w.until.After(w.since) {
+		return fmt.Errorf("--until %s is not after --since %s", w.until.Format(time.RFC3339), w.since.Format(time.RFC3339))
+	}
+
+	w.checkpoint = map[string]time.Time{}
+	w.seen = map[string]time.Time{}
+	if w.Checkpoint == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(w.Checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint %s: %v", w.Checkpoint, err)
+	}
+
+	if err := json.Unmarshal(data, &w.checkpoint); err != nil {
+		return fmt.Errorf("invalid checkpoint %s: %v", w.Checkpoint, err)
+	}
+
+	// Logs are only requested from the oldest checkpoint on, sources the
+	// checkpoint doesn't know yet included. Lines at a checkpoint itself
+	// were already seen.
+	var oldest time.Time
+	for _, ts := range w.checkpoint {
+		if oldest.IsZero() || ts.Before(oldest) {
+			oldest = ts
+		}
+	}
+	if next := oldest.Add(time.Nanosecond); !oldest.IsZero() && next.After(w.since) {
+		w.since = next
+	}
+
+	return nil
+}
+
+// SinceTime is the earliest time to ask the runtime for logs from, or the
+// zero time for all of them.
+func (w *Window) SinceTime() time.Time {
+	return w.since
+}
+
+// UntilTime is the latest time to ask the runtime for logs up to, or the
+// zero time for no limit.
+func (w *Window) UntilTime() time.Time {
+	return w.until
+}
+
+// Contains reports whether a line source logged at ts is in the window and
+// records it for the checkpoint. Lines without a timestamp are always in it.
+func (w *Window) Contains(source string, ts time.Time) bool {
+	if ts.IsZero() {
+		return true
+	}
+	if !w.since.IsZero() && ts.Before(w.since) {
+		return false
+	}
+	if !w.until.IsZero() && !ts.Before(w.until) {
+		return false
+	}
+	if last, ok := w.checkpoint[source]; ok && !ts.After(last) {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen == nil {
+		w.seen = map[string]time.Time{}
+	}
+	if ts.After(w.seen[source]) {
+		w.seen[source] = ts
+	}
+
+	return true
+}
+
+// Save writes the newest timestamp seen from each source to the checkpoint
+// file, if any, keeping those of sources this run didn't see.
+func (w *Window) Save() error {
+	if w.Checkpoint == "" {
+		return nil
+	}
+
+	w.mu.Lock()
+	seen := maps.Clone(w.seen)
+	w.mu.Unlock()
+
+	if len(seen) == 0 {
+		return nil
+	}
+
+	checkpoint := maps.Clone(w.checkpoint)
+	if checkpoint == nil {
+		checkpoint = map[string]time.Time{}
+	}
+	for source, ts := range seen {
+		checkpoint[source] = ts.UTC()
+	}
+
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %v", err)
+	}
+
+	if err := os.WriteFile(w.Checkpoint, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint %s: %v", w.Checkpoint, err)
+	}
+
+	return nil
+}
+
+// SplitTimestamp splits the RFC3339 timestamp docker and kubernetes prefix
+// log lines with off the line. Lines without one are returned as is.
+func SplitTimestamp(line string) (time.Time, string) {
+	prefix, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		prefix = line
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line
+	}
+
+	return ts, rest
+}
+
+// parseTime accepts a duration before now or an RFC3339 timestamp.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("negative duration %q", s)
+		}
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC3339 timestamp", s)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,160 @@
+package logmatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		since      string
+		until      string
+		checkpoint string
+		in         []time.Time
+		out        []time.Time
+		wantErr    bool
+	}{
+		{
+			name:  "relative since",
+			since: "5m",
+			in:    []time.Time{now.Add(-time.Minute), now.Add(-5 * time.Minute)},
+			out:   []time.Time{now.Add(-6 * time.Minute)},
+		},
+		{
+			name:  "absolute since and until",
+			since: "2025-01-01T11:00:00Z",
+			until: "2025-01-01T11:30:00Z",
+			in:    []time.Time{now.Add(-time.Hour), now.Add(-45 * time.Minute)},
+			out:   []time.Time{now.Add(-61 * time.Minute), now.Add(-30 * time.Minute)},
+		},
+		{
+			name:       "checkpoint narrows since",
+			since:      "1h",
+			checkpoint: `{"app": "2025-01-01T11:50:00.5Z"}`,
+			in:         []time.Time{now.Add(-9 * time.Minute)},
+			out:        []time.Time{time.Date(2025, 1, 1, 11, 50, 0, 500000000, time.UTC)},
+		},
+		{
+			name:    "until before since",
+			since:   "1m",
+			until:   "5m",
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			since:   "yesterday",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Window{Since: tt.since, Until: tt.until}
+			if tt.checkpoint != "" {
+				w.Checkpoint = filepath.Join(t.TempDir(), "checkpoint")
+				require.NoError(t, os.WriteFile(w.Checkpoint, []byte(tt.checkpoint+"\n"), 0o644))
+			}
+
+			err := w.Resolve(now)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			for _, ts := range tt.in {
+				require.True(t, w.Contains("app", ts), ts)
+			}
+			for _, ts := range tt.out {
+				require.False(t, w.Contains("app", ts), ts)
+			}
+			require.True(t, w.Contains("app", time.Time{}))
+		})
+	}
+}
+
+func TestWindowCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	now := time.Now()
+	first := now.Add(-2 * time.Second).UTC()
+	second := now.Add(-time.Second).UTC()
+
+	w := &Window{Checkpoint: path}
+	require.NoError(t, w.Resolve(now))
+	require.True(t, w.Contains("app", first))
+	require.NoError(t, w.Save())
+
+	// The next run only sees what's newer than the first run did
+	w = &Window{Checkpoint: path}
+	require.NoError(t, w.Resolve(now))
+	require.False(t, w.Contains("app", first))
+	require.True(t, w.Contains("app", second))
+	require.NoError(t, w.Save())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"app": "`+second.Format(time.RFC3339Nano)+`"}`, string(data))
+}
+
+func TestWindowCheckpointPerSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return now.Add(time.Duration(s) * time.Second) }
+
+	// web is read up to 10s, while db lags behind and stops reading at 3s,
+	// say because its pattern already matched
+	w := &Window{Checkpoint: path}
+	require.NoError(t, w.Resolve(now))
+	for _, l := range []struct {
+		source string
+		s      int
+	}{{"web", 1}, {"db", 2}, {"web", 5}, {"db", 3}, {"web", 10}} {
+		require.True(t, w.Contains(l.source, at(l.s)))
+	}
+	require.NoError(t, w.Save())
+
+	// The next run is asked for logs from the lagging source's checkpoint
+	// on, and each source picks up right after its own
+	w = &Window{Checkpoint: path}
+	require.NoError(t, w.Resolve(now))
+	require.Equal(t, at(3).Add(time.Nanosecond), w.SinceTime())
+
+	require.False(t, w.Contains("db", at(3)))
+	require.True(t, w.Contains("db", at(4)))
+	require.True(t, w.Contains("db", at(8)))
+	require.False(t, w.Contains("web", at(8)))
+	require.True(t, w.Contains("web", at(11)))
+	require.True(t, w.Contains("cache", at(4)), "a new source gets every line in the window")
+	require.NoError(t, w.Save())
+
+	// Sources a run doesn't see keep their checkpoint
+	w = &Window{Checkpoint: path}
+	require.NoError(t, w.Resolve(now))
+	require.True(t, w.Contains("db", at(9)))
+	require.NoError(t, w.Save())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"cache": "2025-01-01T12:00:04Z",
+		"db": "2025-01-01T12:00:09Z",
+		"web": "2025-01-01T12:00:11Z"
+	}`, string(data))
+}
+
+func TestSplitTimestamp(t *testing.T) {
+	ts, text := SplitTimestamp("2025-01-01T12:00:00.123456789Z server started")
+	require.Equal(t, time.Date(2025, 1, 1, 12, 0, 0, 123456789, time.UTC), ts)
+	require.Equal(t, "server started", text)
+
+	ts, text = SplitTimestamp("no timestamp here")
+	require.True(t, ts.IsZero())
+	require.Equal(t, "no timestamp here", text)
+}